@@ -15,6 +15,8 @@ import (
 
 	"github.com/pwegrzyn/kubernetes-operators-project/pkg/apis"
 	"github.com/pwegrzyn/kubernetes-operators-project/pkg/controller"
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/exporter"
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/webhook"
 	"github.com/pwegrzyn/kubernetes-operators-project/version"
 
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
@@ -39,6 +41,9 @@ var (
 	metricsPort         int32 = 8383
 	operatorMetricsPort int32 = 8686
 )
+
+// Change below variable to serve the admission webhooks on a different port.
+var webhookPort = 9443
 var log = logf.Log.WithName("cmd")
 
 func printVersion() {
@@ -49,6 +54,16 @@ func printVersion() {
 }
 
 func main() {
+	// The same image runs the metrics exporter sidecar of the H2 pods, it has its own flags
+	if len(os.Args) > 1 && os.Args[1] == exporter.Command {
+		logf.SetLogger(zap.Logger())
+		if err := exporter.Run(os.Args[2:]); err != nil {
+			log.Error(err, "Exporter failed")
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Add the zap logger flag set to the CLI. The flag set must
 	// be added before calling pflag.Parse().
 	pflag.CommandLine.AddFlagSet(zap.FlagSet())
@@ -96,6 +111,7 @@ func main() {
 	options := manager.Options{
 		Namespace:          namespace,
 		MetricsBindAddress: fmt.Sprintf("%s:%d", metricsHost, metricsPort),
+		Port:               webhookPort,
 	}
 
 	// Add support for MultiNamespace set in WATCH_NAMESPACE (e.g ns1,ns2)
@@ -128,6 +144,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Setup all Webhooks
+	// NOTE: The webhook server needs a serving certificate, set ENABLE_WEBHOOKS=false
+	// when running the operator locally without one.
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err := webhook.AddToManager(mgr); err != nil {
+			log.Error(err, "")
+			os.Exit(1)
+		}
+	}
+
 	// Add the Metrics Service
 	addMetrics(ctx, cfg)
 
@@ -3,9 +3,8 @@ module github.com/pwegrzyn/kubernetes-operators-project
 go 1.13
 
 require (
-	github.com/google/uuid v1.1.1
 	github.com/operator-framework/operator-sdk v0.17.0
-	github.com/sirupsen/logrus v1.5.0
+	github.com/prometheus/client_golang v1.5.1
 	github.com/spf13/pflag v1.0.5
 	k8s.io/api v0.17.4
 	k8s.io/apimachinery v0.17.4
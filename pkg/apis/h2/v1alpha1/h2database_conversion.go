@@ -0,0 +1,116 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// hubSpecAnnotation preserves the v1alpha2 spec, which has fields v1alpha1 cannot represent
+// (e.g. the backup trigger), so that a round trip through v1alpha1 is lossless.
+const hubSpecAnnotation = "h2.example.com/v1alpha2-spec"
+
+// hubStatusAnnotation preserves the v1alpha2 status likewise, v1alpha1 only reports the nodes
+const hubStatusAnnotation = "h2.example.com/v1alpha2-status"
+
+var _ conversion.Convertible = &H2Database{}
+
+// ConvertTo converts this H2Database to the Hub version (v1alpha2).
+// The 'skip' backup sentinel becomes an empty URL, and both 'yes' and 'issued'
+// clustering modes enable clustering; whether the cluster has been formed is
+// tracked in the v1alpha2 status.
+// The fields v1alpha1 represents override the ones preserved in the annotations, which are
+// left untouched by the edits made through v1alpha1.
+func (src *H2Database) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha2.H2Database)
+
+	dst.ObjectMeta = src.ObjectMeta
+	if data, ok := src.Annotations[hubSpecAnnotation]; ok {
+		if err := json.Unmarshal([]byte(data), &dst.Spec); err != nil {
+			return err
+		}
+	}
+	if data, ok := src.Annotations[hubStatusAnnotation]; ok {
+		if err := json.Unmarshal([]byte(data), &dst.Status); err != nil {
+			return err
+		}
+	}
+	if src.Annotations != nil {
+		dst.Annotations = copyAnnotationsWithout(src.Annotations, hubSpecAnnotation, hubStatusAnnotation)
+	}
+
+	dst.Spec.Size = src.Spec.Size
+	dst.Spec.Image = src.Spec.Image
+	dst.Spec.CacheSize = src.Spec.CachSize
+	dst.Spec.Storage = v1alpha2.H2DatabaseStorage{
+		Size:             src.Spec.Storage.Size,
+		StorageClassName: src.Spec.Storage.StorageClassName,
+	}
+	dst.Spec.ServerModes = nil
+	for _, mode := range src.Spec.ServerModes {
+		dst.Spec.ServerModes = append(dst.Spec.ServerModes, v1alpha2.H2ServerMode(mode))
+	}
+	dst.Spec.Clustering.Enabled = src.Spec.Clustering == "yes" || src.Spec.Clustering == "issued"
+	dst.Spec.Backup.URL = ""
+	if src.Spec.Backup != DefaultBackup {
+		dst.Spec.Backup.URL = src.Spec.Backup
+	}
+
+	dst.Status.Nodes = src.Status.Nodes
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha2) to this version.
+func (dst *H2Database) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha2.H2Database)
+
+	dst.ObjectMeta = src.ObjectMeta
+	spec, err := json.Marshal(src.Spec)
+	if err != nil {
+		return err
+	}
+	status, err := json.Marshal(src.Status)
+	if err != nil {
+		return err
+	}
+	dst.Annotations = copyAnnotationsWithout(src.Annotations, hubSpecAnnotation, hubStatusAnnotation)
+	dst.Annotations[hubSpecAnnotation] = string(spec)
+	dst.Annotations[hubStatusAnnotation] = string(status)
+
+	dst.Spec.Size = src.Spec.Size
+	dst.Spec.Image = src.Spec.Image
+	dst.Spec.CachSize = src.Spec.CacheSize
+	dst.Spec.Storage = H2DatabaseStorage{
+		Size:             src.Spec.Storage.Size,
+		StorageClassName: src.Spec.Storage.StorageClassName,
+	}
+	dst.Spec.ServerModes = nil
+	for _, mode := range src.Spec.ServerModes {
+		dst.Spec.ServerModes = append(dst.Spec.ServerModes, H2ServerMode(mode))
+	}
+	dst.Spec.Clustering = DefaultClustering
+	if src.Spec.Clustering.Enabled {
+		dst.Spec.Clustering = "yes"
+	}
+	dst.Spec.Backup = DefaultBackup
+	if src.Spec.Backup.URL != "" {
+		dst.Spec.Backup = src.Spec.Backup.URL
+	}
+
+	dst.Status.Nodes = src.Status.Nodes
+	return nil
+}
+
+// copyAnnotationsWithout returns a copy of the annotations without the given keys,
+// so that the converted object does not share the map with its source
+func copyAnnotationsWithout(annotations map[string]string, keys ...string) map[string]string {
+	out := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		out[k] = v
+	}
+	for _, key := range keys {
+		delete(out, key)
+	}
+	return out
+}
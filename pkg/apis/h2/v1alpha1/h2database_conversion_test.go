@@ -0,0 +1,228 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+// newTestHub returns a v1alpha2 H2Database using fields v1alpha1 cannot represent
+func newTestHub() *v1alpha2.H2Database {
+	backupTime := metav1.NewTime(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	h := &v1alpha2.H2Database{ObjectMeta: metav1.ObjectMeta{
+		Name:        "example",
+		Namespace:   "default",
+		Annotations: map[string]string{"h2.example.com/maintenance": "true"},
+	}}
+	h.Spec.Size = int32Ptr(2)
+	h.Spec.Image = "oscarfonts/h2:2.1.214"
+	h.Spec.CacheSize = 16384
+	h.Spec.Storage.Size = resource.MustParse("2Gi")
+	h.Spec.ServerModes = []v1alpha2.H2ServerMode{v1alpha2.ServerModeTCP, v1alpha2.ServerModePG}
+	h.Spec.Clustering.Enabled = true
+	h.Spec.Backup = v1alpha2.H2DatabaseBackup{URL: "https://backups.example.com/h2", Trigger: "2", DeleteURL: "https://backups.example.com/h2"}
+	h.Spec.TLS.Enabled = true
+	h.Spec.Upgrade.Strategy = v1alpha2.UpgradeStrategyMigrate
+	h.Spec.DeletionPolicy = v1alpha2.DeletionPolicyRetain
+	h.Status = v1alpha2.H2DatabaseStatus{
+		ObservedGeneration: 3,
+		Phase:              v1alpha2.PhaseRunning,
+		Conditions: status.Conditions{{
+			Type:               v1alpha2.ConditionAvailable,
+			Status:             corev1.ConditionTrue,
+			Reason:             "InstancesReady",
+			LastTransitionTime: backupTime,
+		}},
+		Nodes:          []string{"example-0", "example-1"},
+		Replicas:       2,
+		ReadyReplicas:  2,
+		ClusterState:   v1alpha2.ClusterStateFormed,
+		LastBackupHash: "0123",
+		LastBackupTime: &backupTime,
+		Binding:        &corev1.LocalObjectReference{Name: "example-binding"},
+		Image:          "oscarfonts/h2:2.1.214",
+		Upgrade: &v1alpha2.H2DatabaseUpgradeStatus{
+			Phase:       v1alpha2.UpgradePhaseSucceeded,
+			SourceImage: "oscarfonts/h2:1.4.200",
+			TargetImage: "oscarfonts/h2:2.1.214",
+			StartTime:   backupTime,
+			Rows:        3,
+		},
+	}
+	return h
+}
+
+func TestConvertFromHubRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(h *v1alpha2.H2Database)
+	}{
+		{"every field", func(h *v1alpha2.H2Database) {}},
+		{"no backup nor clustering", func(h *v1alpha2.H2Database) {
+			h.Spec.Backup = v1alpha2.H2DatabaseBackup{}
+			h.Spec.Clustering.Enabled = false
+		}},
+		{"no annotation nor status", func(h *v1alpha2.H2Database) {
+			h.Annotations = nil
+			h.Status = v1alpha2.H2DatabaseStatus{}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := newTestHub()
+			tt.mutate(hub)
+			original := hub.DeepCopy()
+
+			spoke := &H2Database{}
+			if err := spoke.ConvertFrom(hub); err != nil {
+				t.Fatalf("ConvertFrom failed: %v", err)
+			}
+			if !equality.Semantic.DeepEqual(hub, original) {
+				t.Errorf("Expected ConvertFrom to leave its source untouched, got %+v", hub)
+			}
+			got := &v1alpha2.H2Database{}
+			if err := spoke.ConvertTo(got); err != nil {
+				t.Fatalf("ConvertTo failed: %v", err)
+			}
+			if !equality.Semantic.DeepEqual(got.ObjectMeta, original.ObjectMeta) {
+				t.Errorf("Expected the metadata to survive the round trip, got %+v", got.ObjectMeta)
+			}
+			if !equality.Semantic.DeepEqual(got.Spec, original.Spec) {
+				t.Errorf("Expected the spec to survive the round trip, got %+v, want %+v", got.Spec, original.Spec)
+			}
+			if !equality.Semantic.DeepEqual(got.Status, original.Status) {
+				t.Errorf("Expected the status to survive the round trip, got %+v, want %+v", got.Status, original.Status)
+			}
+		})
+	}
+}
+
+func TestConvertToHubRoundTrip(t *testing.T) {
+	tests := []struct {
+		name            string
+		backup          string
+		clustering      string
+		wantClustering  string
+		wantBackupURL   string
+		wantClusterMode bool
+	}{
+		{"defaults", DefaultBackup, DefaultClustering, DefaultClustering, "", false},
+		{"backup and clustering", "https://backups.example.com/h2", "yes", "yes", "https://backups.example.com/h2", true},
+		// Whether the cluster has been formed moved to the v1alpha2 status
+		{"issued clustering", DefaultBackup, "issued", "yes", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spoke := &H2Database{ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"}}
+			spoke.Spec.Size = int32Ptr(2)
+			spoke.Spec.Image = "oscarfonts/h2:alpine"
+			spoke.Spec.CachSize = 8192
+			spoke.Spec.Storage.Size = resource.MustParse("1Gi")
+			spoke.Spec.ServerModes = []H2ServerMode{"tcp", "web"}
+			spoke.Spec.Backup = tt.backup
+			spoke.Spec.Clustering = tt.clustering
+			spoke.Status.Nodes = []string{"example-0"}
+
+			hub := &v1alpha2.H2Database{}
+			if err := spoke.ConvertTo(hub); err != nil {
+				t.Fatalf("ConvertTo failed: %v", err)
+			}
+			if hub.Spec.Backup.URL != tt.wantBackupURL || hub.Spec.Clustering.Enabled != tt.wantClusterMode {
+				t.Errorf("Expected the backup URL %q and clustering %t, got %+v", tt.wantBackupURL, tt.wantClusterMode, hub.Spec)
+			}
+			if hub.Spec.CacheSize != 8192 || len(hub.Spec.ServerModes) != 2 || hub.Spec.ServerModes[1] != v1alpha2.ServerModeWeb {
+				t.Errorf("Expected the cache size and server modes to be converted, got %+v", hub.Spec)
+			}
+
+			got := &H2Database{}
+			if err := got.ConvertFrom(hub); err != nil {
+				t.Fatalf("ConvertFrom failed: %v", err)
+			}
+			if _, ok := got.Annotations[hubSpecAnnotation]; !ok {
+				t.Errorf("Expected the v1alpha2 spec to be preserved, got %v", got.Annotations)
+			}
+			if _, ok := got.Annotations[hubStatusAnnotation]; !ok {
+				t.Errorf("Expected the v1alpha2 status to be preserved, got %v", got.Annotations)
+			}
+			want := spoke.DeepCopy()
+			want.Spec.Clustering = tt.wantClustering
+			if !equality.Semantic.DeepEqual(got.Spec, want.Spec) || !equality.Semantic.DeepEqual(got.Status, want.Status) {
+				t.Errorf("Expected %+v, got %+v", want.Spec, got.Spec)
+			}
+		})
+	}
+}
+
+func TestConvertToHubWithoutAnnotation(t *testing.T) {
+	spoke := &H2Database{ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"}}
+	spoke.Spec.Size = int32Ptr(1)
+	spoke.Spec.Backup = DefaultBackup
+	spoke.Spec.Clustering = DefaultClustering
+	spoke.Status.Nodes = []string{"example-0"}
+
+	hub := &v1alpha2.H2Database{}
+	if err := spoke.ConvertTo(hub); err != nil {
+		t.Fatalf("ConvertTo failed: %v", err)
+	}
+	if hub.Annotations != nil {
+		t.Errorf("Expected no annotation, got %v", hub.Annotations)
+	}
+	if hub.Spec.TLS.Enabled || hub.Spec.Backup.Trigger != "" || hub.Spec.Upgrade.Strategy != "" {
+		t.Errorf("Expected the fields v1alpha1 lacks to be left to the defaults, got %+v", hub.Spec)
+	}
+	want := v1alpha2.H2DatabaseStatus{Nodes: []string{"example-0"}}
+	if !equality.Semantic.DeepEqual(hub.Status, want) {
+		t.Errorf("Expected only the nodes in the status, got %+v", hub.Status)
+	}
+}
+
+func TestConvertToHubAfterSpokeEdit(t *testing.T) {
+	spoke := &H2Database{}
+	if err := spoke.ConvertFrom(newTestHub()); err != nil {
+		t.Fatalf("ConvertFrom failed: %v", err)
+	}
+	// A v1alpha1 client edits the object, the annotations still hold the former values
+	spoke.Spec.Size = int32Ptr(1)
+	spoke.Spec.Image = "oscarfonts/h2:2.2.220"
+	spoke.Spec.Backup = DefaultBackup
+	spoke.Spec.Clustering = DefaultClustering
+	spoke.Spec.ServerModes = []H2ServerMode{"pg"}
+	spoke.Status.Nodes = []string{"example-0"}
+
+	hub := &v1alpha2.H2Database{}
+	if err := spoke.ConvertTo(hub); err != nil {
+		t.Fatalf("ConvertTo failed: %v", err)
+	}
+	if *hub.Spec.Size != 1 || hub.Spec.Image != "oscarfonts/h2:2.2.220" || hub.Spec.Clustering.Enabled ||
+		len(hub.Spec.ServerModes) != 1 || hub.Spec.ServerModes[0] != v1alpha2.ServerModePG {
+		t.Errorf("Expected the v1alpha1 edits to win over the annotation, got %+v", hub.Spec)
+	}
+	if hub.Spec.Backup.URL != "" || hub.Spec.Backup.Trigger != "2" {
+		t.Errorf("Expected the backup URL to be cleared and the trigger kept, got %+v", hub.Spec.Backup)
+	}
+	if !hub.Spec.TLS.Enabled || hub.Spec.DeletionPolicy != v1alpha2.DeletionPolicyRetain {
+		t.Errorf("Expected the fields v1alpha1 lacks to be kept, got %+v", hub.Spec)
+	}
+	if len(hub.Status.Nodes) != 1 || hub.Status.Nodes[0] != "example-0" || hub.Status.ClusterState != v1alpha2.ClusterStateFormed {
+		t.Errorf("Expected the nodes from v1alpha1 and the other status fields from the annotation, got %+v", hub.Status)
+	}
+	if _, ok := hub.Annotations[hubSpecAnnotation]; ok {
+		t.Errorf("Expected the v1alpha2 spec annotation to be removed, got %v", hub.Annotations)
+	}
+	if _, ok := hub.Annotations[hubStatusAnnotation]; ok {
+		t.Errorf("Expected the v1alpha2 status annotation to be removed, got %v", hub.Annotations)
+	}
+	if hub.Annotations["h2.example.com/maintenance"] != "true" {
+		t.Errorf("Expected the other annotations to be kept, got %v", hub.Annotations)
+	}
+}
@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -18,21 +19,69 @@ type H2DatabaseSpec struct {
 	// Imporant: having more that 2 pods in the deplyoment is probably not necessary,
 	// as currently H2 only supports running on a single node or in HA mode with
 	// a cluster of size 2
-	Size int32 `json:"size"`
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=1
+	// +optional
+	Size *int32 `json:"size,omitempty"`
+
+	// Image is the H2 container image, it is expected to follow the layout of oscarfonts/h2
+	// +kubebuilder:default="oscarfonts/h2:alpine"
+	// +optional
+	Image string `json:"image,omitempty"`
 
 	// URL to which the operator should POST DB backups, leave as 'skip' string if you don't want backups
-	Backup string `json:"backup"`
+	// +kubebuilder:default="skip"
+	// +optional
+	Backup string `json:"backup,omitempty"`
 
 	// Indicate whether to try to run the DBs as a connected cluster; will only be considered when there
 	// are exactly two DB instances running (since H2 demands it); 'yes' or 'no'
-	Clustering string `json:"clustering"`
+	// +kubebuilder:validation:Enum=yes;no;issued
+	// +kubebuilder:default="no"
+	// +optional
+	Clustering string `json:"clustering,omitempty"`
 
-	// Desired Cache Size of H2.
+	// Desired Cache Size of H2 in KB.
 	// For more info please visit https://www.h2database.com/html/features.html#cache_settings
-	// TODO: implement handler
-	CachSize int32 `json:"cacheSize"`
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=16384
+	// +optional
+	CachSize int32 `json:"cacheSize,omitempty"`
+
+	// Storage describes the volumes holding the data directories, every H2 instance gets its own.
+	// NOTE: The volumes are claimed from the storage section the H2 CR is created with, later changes are ignored.
+	// +kubebuilder:default={size: "1Gi"}
+	// +optional
+	Storage H2DatabaseStorage `json:"storage,omitempty"`
+
+	// ServerModes lists the H2 servers started in every pod
+	// +kubebuilder:default={"tcp"}
+	// +optional
+	ServerModes []H2ServerMode `json:"serverModes,omitempty"`
 }
 
+// H2DatabaseStorage describes the PersistentVolumeClaims backing the H2 data directories
+type H2DatabaseStorage struct {
+	// Size is the requested capacity of the claim
+	// +kubebuilder:default="1Gi"
+	// +optional
+	Size resource.Quantity `json:"size,omitempty"`
+
+	// StorageClassName of the claim, the cluster default class is used when empty
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+}
+
+// H2ServerMode is one of the servers H2 can expose: tcp, pg (PostgreSQL protocol) or web (console)
+// +kubebuilder:validation:Enum=tcp;pg;web
+type H2ServerMode string
+
+const (
+	ServerModeTCP H2ServerMode = "tcp"
+	ServerModePG  H2ServerMode = "pg"
+	ServerModeWeb H2ServerMode = "web"
+)
+
 // H2DatabaseStatus defines the observed state of H2Database
 // +k8s:openapi-gen=true
 type H2DatabaseStatus struct {
@@ -0,0 +1,72 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// Defaults applied to H2Database specs. They are mirrored by the +kubebuilder:default
+// markers in h2database_types.go, so keep both in sync.
+const (
+	DefaultSize        int32 = 1
+	DefaultImage             = "oscarfonts/h2:alpine"
+	DefaultBackup            = "skip"
+	DefaultClustering        = "no"
+	DefaultCacheSize   int32 = 16384
+	DefaultStorageSize       = "1Gi"
+)
+
+var h2databaselog = logf.Log.WithName("h2database-resource")
+
+// SetupWebhookWithManager registers the H2Database webhooks with the manager's webhook server
+func (r *H2Database) SetupWebhookWithManager(mgr manager.Manager) error {
+	return builder.WebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-h2-example-com-v1alpha1-h2database,mutating=true,failurePolicy=fail,groups=h2.example.com,resources=h2databases,verbs=create;update,versions=v1alpha1,name=mh2database.kb.io
+
+var _ webhook.Defaulter = &H2Database{}
+
+// Default fills in the unset fields of the spec. It is called by the mutating webhook,
+// and by the controller so that objects admitted without the webhook behave the same.
+func (r *H2Database) Default() {
+	h2databaselog.V(1).Info("default", "name", r.Name)
+
+	if r.Spec.Size == nil {
+		size := DefaultSize
+		r.Spec.Size = &size
+	}
+	if r.Spec.Image == "" {
+		r.Spec.Image = DefaultImage
+	}
+	if r.Spec.Backup == "" {
+		r.Spec.Backup = DefaultBackup
+	}
+	if r.Spec.Clustering == "" {
+		r.Spec.Clustering = DefaultClustering
+	}
+	if r.Spec.CachSize == 0 {
+		r.Spec.CachSize = DefaultCacheSize
+	}
+	if r.Spec.Storage.Size.IsZero() {
+		r.Spec.Storage.Size = resource.MustParse(DefaultStorageSize)
+	}
+	if len(r.Spec.ServerModes) == 0 {
+		r.Spec.ServerModes = []H2ServerMode{ServerModeTCP}
+	}
+}
+
+// HasServerMode returns true if the given H2 server is enabled in the spec
+func (r *H2Database) HasServerMode(mode H2ServerMode) bool {
+	for _, m := range r.Spec.ServerModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
@@ -13,7 +13,7 @@ func (in *H2Database) DeepCopyInto(out *H2Database) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 	return
 }
@@ -72,6 +72,17 @@ func (in *H2DatabaseList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *H2DatabaseSpec) DeepCopyInto(out *H2DatabaseSpec) {
 	*out = *in
+	if in.Size != nil {
+		in, out := &in.Size, &out.Size
+		*out = new(int32)
+		**out = **in
+	}
+	in.Storage.DeepCopyInto(&out.Storage)
+	if in.ServerModes != nil {
+		in, out := &in.ServerModes, &out.ServerModes
+		*out = make([]H2ServerMode, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -105,3 +116,25 @@ func (in *H2DatabaseStatus) DeepCopy() *H2DatabaseStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseStorage) DeepCopyInto(out *H2DatabaseStorage) {
+	*out = *in
+	out.Size = in.Size.DeepCopy()
+	if in.StorageClassName != nil {
+		in, out := &in.StorageClassName, &out.StorageClassName
+		*out = new(string)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseStorage.
+func (in *H2DatabaseStorage) DeepCopy() *H2DatabaseStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseStorage)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,4 @@
+// Package v1alpha2 contains API Schema definitions for the h2 v1alpha2 API group
+// +k8s:deepcopy-gen=package,register
+// +groupName=h2.example.com
+package v1alpha2
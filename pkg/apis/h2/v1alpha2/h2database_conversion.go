@@ -0,0 +1,4 @@
+package v1alpha2
+
+// Hub marks v1alpha2 as the version every other H2Database version converts to and from.
+func (*H2Database) Hub() {}
@@ -0,0 +1,594 @@
+package v1alpha2
+
+import (
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
+
+// H2DatabaseSpec defines the desired state of H2Database
+// +k8s:openapi-gen=true
+type H2DatabaseSpec struct {
+	// Size is the size of the h2 deployment
+	// Imporant: having more that 2 pods in the deplyoment is probably not necessary,
+	// as currently H2 only supports running on a single node or in HA mode with
+	// a cluster of size 2
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=1
+	// +optional
+	Size *int32 `json:"size,omitempty"`
+
+	// Image is the H2 container image, it is expected to follow the layout of oscarfonts/h2
+	// +kubebuilder:default="oscarfonts/h2:alpine"
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Desired Cache Size of H2 in KB.
+	// For more info please visit https://www.h2database.com/html/features.html#cache_settings
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=16384
+	// +optional
+	CacheSize int32 `json:"cacheSize,omitempty"`
+
+	// Storage describes the volumes holding the data directories, every H2 instance gets its own.
+	// NOTE: The volumes are claimed from the storage section the H2 CR is created with, later changes are ignored.
+	// +kubebuilder:default={size: "1Gi"}
+	// +optional
+	Storage H2DatabaseStorage `json:"storage,omitempty"`
+
+	// ServerModes lists the H2 servers started in every pod
+	// +kubebuilder:default={"tcp"}
+	// +optional
+	ServerModes []H2ServerMode `json:"serverModes,omitempty"`
+
+	// Clustering configures running the DBs as a connected H2 cluster
+	// +optional
+	Clustering H2DatabaseClustering `json:"clustering,omitempty"`
+
+	// Backup configures backups of the H2 data directory
+	// +optional
+	Backup H2DatabaseBackup `json:"backup,omitempty"`
+
+	// Database is the name of the H2 database created in the data directory
+	// +kubebuilder:default="h2"
+	// +optional
+	Database string `json:"database,omitempty"`
+
+	// Credentials configures the admin user of the database
+	// +optional
+	Credentials H2DatabaseCredentials `json:"credentials,omitempty"`
+
+	// TLS configures encryption of the connections to the H2 TCP server
+	// +optional
+	TLS H2DatabaseTLS `json:"tls,omitempty"`
+
+	// NetworkPolicy restricts which pods can connect to the H2 servers
+	// +optional
+	NetworkPolicy H2DatabaseNetworkPolicy `json:"networkPolicy,omitempty"`
+
+	// SecurityContext configures the hardening of the H2 pods. By default they run as a non-root user
+	// with a read-only root filesystem, no capabilities and the runtime's default seccomp profile,
+	// as required by the 'restricted' Pod Security Standard.
+	// +optional
+	SecurityContext H2DatabaseSecurityContext `json:"securityContext,omitempty"`
+
+	// Binding configures the connection details published for applications
+	// +optional
+	Binding H2DatabaseBinding `json:"binding,omitempty"`
+
+	// Console configures the H2 web console
+	// +optional
+	Console H2DatabaseConsole `json:"console,omitempty"`
+
+	// Service configures the Service exposing the H2 servers
+	// +optional
+	Service H2DatabaseService `json:"service,omitempty"`
+
+	// Probes tunes the probes of the H2 container
+	// +optional
+	Probes H2DatabaseProbes `json:"probes,omitempty"`
+
+	// Metrics adds a Prometheus exporter sidecar to the H2 pods
+	// +optional
+	Metrics H2DatabaseMetrics `json:"metrics,omitempty"`
+
+	// DeletionPolicy tells what happens to the data when the H2Database is deleted
+	// +kubebuilder:default=Delete
+	// +optional
+	DeletionPolicy H2DatabaseDeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// Upgrade configures how the data is carried over to a new image
+	// +optional
+	Upgrade H2DatabaseUpgrade `json:"upgrade,omitempty"`
+}
+
+// H2DatabaseUpgrade configures how the data is carried over to a new image
+type H2DatabaseUpgrade struct {
+	// Strategy is Migrate to export the data with the old image and import it with the new one into a fresh
+	// data directory, as required between H2 versions with incompatible file formats (e.g. 1.4 to 2.x), or
+	// InPlace to restart the database on the new image with the same data directory. InPlace image changes
+	// are only accepted between tags of the same H2 major version.
+	// +kubebuilder:default=Migrate
+	// +optional
+	Strategy H2DatabaseUpgradeStrategy `json:"strategy,omitempty"`
+
+	// ImportOptions are appended to the RUNSCRIPT statement importing the data, e.g. FROM_1X when migrating to H2 2.x
+	// +optional
+	ImportOptions string `json:"importOptions,omitempty"`
+}
+
+// H2DatabaseUpgradeStrategy tells how the data is carried over to a new image
+// +kubebuilder:validation:Enum=InPlace;Migrate
+type H2DatabaseUpgradeStrategy string
+
+const (
+	UpgradeStrategyInPlace H2DatabaseUpgradeStrategy = "InPlace"
+	UpgradeStrategyMigrate H2DatabaseUpgradeStrategy = "Migrate"
+)
+
+// H2DatabaseUpgradePhase is the progress of the migration of the data to a new image
+type H2DatabaseUpgradePhase string
+
+const (
+	// UpgradePhaseExporting means the clients are cut off and the data is being dumped with the old image
+	UpgradePhaseExporting H2DatabaseUpgradePhase = "Exporting"
+	// UpgradePhaseImporting means the new image is rolling out and the dump is being imported
+	UpgradePhaseImporting H2DatabaseUpgradePhase = "Importing"
+	// UpgradePhaseSucceeded means the new image serves the imported data
+	UpgradePhaseSucceeded H2DatabaseUpgradePhase = "Succeeded"
+	// UpgradePhaseFailed means the old image has been restored along with its data, the migration to the same
+	// target image is not tried again
+	UpgradePhaseFailed H2DatabaseUpgradePhase = "Failed"
+)
+
+// H2DatabaseUpgradeStatus is the progress of the last migration of the data to a new image
+type H2DatabaseUpgradeStatus struct {
+	// Phase of the migration
+	Phase H2DatabaseUpgradePhase `json:"phase"`
+
+	// SourceImage is the image the data is exported with
+	SourceImage string `json:"sourceImage"`
+
+	// TargetImage is the image the data is imported with
+	TargetImage string `json:"targetImage"`
+
+	// TargetDataSubPath is the directory of the data volume the data is imported into
+	TargetDataSubPath string `json:"targetDataSubPath"`
+
+	// StartTime is when the migration started
+	StartTime metav1.Time `json:"startTime"`
+
+	// Tables is the number of tables exported
+	// +optional
+	Tables int32 `json:"tables,omitempty"`
+
+	// Rows is the number of rows exported
+	// +optional
+	Rows int64 `json:"rows,omitempty"`
+
+	// RowCountsHash identifies the row counts of the exported tables, which have to be found again after the import
+	// +optional
+	RowCountsHash string `json:"rowCountsHash,omitempty"`
+
+	// Message tells why the migration failed
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// H2DatabaseDeletionPolicy tells what happens to the data when the H2Database is deleted
+// +kubebuilder:validation:Enum=Delete;Retain;BackupThenDelete
+type H2DatabaseDeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the data volume claim and the generated credentials Secret,
+	// and the backups at the backup deleteURL if set
+	DeletionPolicyDelete H2DatabaseDeletionPolicy = "Delete"
+	// DeletionPolicyRetain keeps the data volume claim and the generated credentials Secret,
+	// which are picked up again by a H2Database of the same name
+	DeletionPolicyRetain H2DatabaseDeletionPolicy = "Retain"
+	// DeletionPolicyBackupThenDelete posts a final backup to the backup URL before deleting the data as Delete does,
+	// the backups are kept
+	DeletionPolicyBackupThenDelete H2DatabaseDeletionPolicy = "BackupThenDelete"
+)
+
+// H2DatabaseMetrics configures the exporter sidecar, which reads INFORMATION_SCHEMA through the PG server
+// of H2 listening on localhost and serves the metrics on the metrics port of the Service
+type H2DatabaseMetrics struct {
+	// Enabled adds the exporter sidecar and creates a ServiceMonitor if the Prometheus Operator is installed
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Image of the exporter, the operator image by default
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Interval between two scrapes of the ServiceMonitor
+	// +kubebuilder:default="30s"
+	// +optional
+	Interval string `json:"interval,omitempty"`
+
+	// QueryStatistics makes the exporter turn on the query statistics of H2 to export the query executions.
+	// NOTE: The statistics are gathered for every statement run against the database, which slows it down.
+	// +optional
+	QueryStatistics bool `json:"queryStatistics,omitempty"`
+}
+
+// H2DatabaseProbes tunes the probes of the H2 container. The startup and liveness probes check that the
+// H2 server accepts TCP connections, the readiness probe opens a JDBC connection and runs 'SELECT 1'.
+type H2DatabaseProbes struct {
+	// +optional
+	Startup H2DatabaseProbe `json:"startup,omitempty"`
+	// +optional
+	Readiness H2DatabaseProbe `json:"readiness,omitempty"`
+	// +optional
+	Liveness H2DatabaseProbe `json:"liveness,omitempty"`
+}
+
+// H2DatabaseProbe tunes a probe, the fields left out or set to zero get defaults suited to the probe
+type H2DatabaseProbe struct {
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// H2DatabaseService configures the Service exposing the H2 servers
+type H2DatabaseService struct {
+	// Type of the Service
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +kubebuilder:default=ClusterIP
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// Annotations of the Service, e.g. for cloud load balancers or MetalLB
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// NodePorts fixes the node ports of the NodePort and LoadBalancer Services, they are allocated by the cluster otherwise
+	// +optional
+	NodePorts H2DatabaseNodePorts `json:"nodePorts,omitempty"`
+
+	// LoadBalancerSourceRanges restricts the clients of a LoadBalancer Service, if supported by the cloud provider
+	// +optional
+	LoadBalancerSourceRanges []string `json:"loadBalancerSourceRanges,omitempty"`
+}
+
+// H2DatabaseNodePorts are the node ports of the H2 servers
+type H2DatabaseNodePorts struct {
+	// +optional
+	TCP int32 `json:"tcp,omitempty"`
+	// +optional
+	PG int32 `json:"pg,omitempty"`
+	// +optional
+	Web int32 `json:"web,omitempty"`
+}
+
+// H2DatabaseConsole configures the H2 web console
+type H2DatabaseConsole struct {
+	// Enabled starts the web console in every pod, as the 'web' server mode does,
+	// and creates the '<name>-console' Service
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// AdminPasswordSecret is the name of a Secret with a 'password' key protecting the console preferences.
+	// When empty, the operator generates the password in the '<name>-console' Secret.
+	// +optional
+	AdminPasswordSecret string `json:"adminPasswordSecret,omitempty"`
+
+	// AllowOthers lets the console accept connections from other hosts than the pod itself.
+	// Without it the console is only reachable with kubectl port-forward, not through the Service or the Ingress.
+	// +optional
+	AllowOthers bool `json:"allowOthers,omitempty"`
+
+	// Ingress exposes the console outside of the cluster
+	// +optional
+	Ingress *H2DatabaseConsoleIngress `json:"ingress,omitempty"`
+}
+
+// H2DatabaseConsoleIngress configures the Ingress exposing the H2 web console
+type H2DatabaseConsoleIngress struct {
+	// Host the console is served at
+	Host string `json:"host"`
+
+	// IngressClassName selects the ingress controller, the cluster default is used when empty
+	// +optional
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+
+	// TLSSecretName is the name of the Secret with the certificate of the host, the console is served over plain HTTP when empty
+	// +optional
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+
+	// Annotations of the Ingress, e.g. to configure the ingress controller or cert-manager
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// H2DatabaseBinding configures the connection details published for applications. They are always
+// published in the '<name>-binding' Secret, laid out as required by the Service Binding for Kubernetes spec.
+type H2DatabaseBinding struct {
+	// ConfigMap also publishes the connection details, without the credentials, in the '<name>-binding' ConfigMap
+	// +optional
+	ConfigMap bool `json:"configMap,omitempty"`
+}
+
+// H2DatabaseSecurityContext configures the hardening of the H2 pods
+type H2DatabaseSecurityContext struct {
+	// RunAsUser is the UID the H2 containers run as, 1000 unless root is allowed
+	// +optional
+	RunAsUser *int64 `json:"runAsUser,omitempty"`
+
+	// FSGroup is the group owning the data volume, 1000 by default
+	// +optional
+	FSGroup *int64 `json:"fsGroup,omitempty"`
+
+	// AllowRoot lets the H2 containers run as root, for legacy images that require it
+	// +optional
+	AllowRoot bool `json:"allowRoot,omitempty"`
+
+	// WritableRootFilesystem mounts the root filesystem of the H2 containers read-write,
+	// for legacy images writing outside of /tmp and the data directory
+	// +optional
+	WritableRootFilesystem bool `json:"writableRootFilesystem,omitempty"`
+}
+
+// H2DatabaseNetworkPolicy restricts which pods can connect to the H2 servers
+type H2DatabaseNetworkPolicy struct {
+	// Enabled makes the operator create a NetworkPolicy only letting the clients listed in 'from',
+	// the other H2 pods of the database and the operator reach the H2 ports
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// From lists the pod and namespace selectors of the allowed clients
+	// +optional
+	From []networkingv1.NetworkPolicyPeer `json:"from,omitempty"`
+}
+
+// H2DatabaseTLS configures encryption of the connections to the H2 TCP server
+type H2DatabaseTLS struct {
+	// Enabled switches the TCP server to TLS, clients connect with jdbc:h2:ssl:// URLs.
+	// NOTE: The H2 PG server has no TLS support, it keeps accepting plaintext connections.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// SecretName is the name of a kubernetes.io/tls Secret holding the serving certificate, e.g. one issued
+	// by cert-manager; its 'ca.crt' key is published as the CA bundle when present.
+	// When empty, the operator creates a self-signed CA and a serving certificate in the '<name>-tls' Secret
+	// and renews them before they expire.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// H2DatabaseCredentials configures the admin user of the database
+type H2DatabaseCredentials struct {
+	// SecretName is the name of a Secret with 'username' and 'password' keys holding the admin credentials.
+	// When empty, the operator generates a password on first provisioning and stores it
+	// in the '<name>-credentials' Secret.
+	// NOTE: The admin user is created along with the database, changing the credentials later on
+	// requires changing the password in H2 as well. Unlike H2Users, the admin password is never rotated
+	// by the operator, since the pods and the remote commands read it from the environment.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// H2DatabaseStorage describes the PersistentVolumeClaims backing the H2 data directories
+type H2DatabaseStorage struct {
+	// Size is the requested capacity of the claim
+	// +kubebuilder:default="1Gi"
+	// +optional
+	Size resource.Quantity `json:"size,omitempty"`
+
+	// StorageClassName of the claim, the cluster default class is used when empty
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+}
+
+// H2ServerMode is one of the servers H2 can expose: tcp, pg (PostgreSQL protocol) or web (console)
+// +kubebuilder:validation:Enum=tcp;pg;web
+type H2ServerMode string
+
+const (
+	ServerModeTCP H2ServerMode = "tcp"
+	ServerModePG  H2ServerMode = "pg"
+	ServerModeWeb H2ServerMode = "web"
+)
+
+// H2DatabaseClustering configures H2 cluster mode
+type H2DatabaseClustering struct {
+	// Enabled indicates whether to try to run the DBs as a connected cluster; will only be
+	// considered when there are exactly two DB instances running (since H2 demands it)
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// H2DatabaseBackup configures backups of the H2 data directory
+type H2DatabaseBackup struct {
+	// URL to which the operator should POST a zip of the database made by H2's BACKUP statement, no backup is taken when empty.
+	// A backup is taken once for every change of the backup section.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// Trigger is an arbitrary value, changing it requests another backup to the same URL
+	// +optional
+	Trigger string `json:"trigger,omitempty"`
+
+	// DeleteURL is sent a DELETE request by the operator when the H2Database is deleted with the Delete policy,
+	// to remove the backups from the remote store
+	// +optional
+	DeleteURL string `json:"deleteURL,omitempty"`
+}
+
+// ClusterState is the progress of forming a H2 cluster
+type ClusterState string
+
+const (
+	// ClusterStateDisabled means clustering is not requested in the spec
+	ClusterStateDisabled ClusterState = "Disabled"
+	// ClusterStatePending means clustering is requested, but there are not exactly two H2 instances running
+	ClusterStatePending ClusterState = "Pending"
+	// ClusterStateFormed means the CreateCluster tool has been run on the H2 instances
+	ClusterStateFormed ClusterState = "Formed"
+	// ClusterStateFailed means the CreateCluster tool failed, it is run again later
+	ClusterStateFailed ClusterState = "Failed"
+)
+
+// H2DatabasePhase is a summary of the state of a H2Database
+type H2DatabasePhase string
+
+const (
+	// PhasePending means the resources of the database are not created or not bound yet
+	PhasePending H2DatabasePhase = "Pending"
+	// PhaseProvisioning means no H2 instance is available yet
+	PhaseProvisioning H2DatabasePhase = "Provisioning"
+	// PhaseRunning means all H2 instances are available
+	PhaseRunning H2DatabasePhase = "Running"
+	// PhaseDegraded means only some of the H2 instances are available
+	PhaseDegraded H2DatabasePhase = "Degraded"
+	// PhaseFailed means the database cannot be provisioned without intervention
+	PhaseFailed H2DatabasePhase = "Failed"
+)
+
+// Condition types reported in the H2Database status
+const (
+	// ConditionAvailable is true when at least one H2 instance accepts connections
+	ConditionAvailable status.ConditionType = "Available"
+	// ConditionProgressing is true while the H2 StatefulSet is rolling out
+	ConditionProgressing status.ConditionType = "Progressing"
+	// ConditionBackupSucceeded reports the result of the last backup
+	ConditionBackupSucceeded status.ConditionType = "BackupSucceeded"
+	// ConditionClusterReady is true when the H2 cluster has been formed
+	ConditionClusterReady status.ConditionType = "ClusterReady"
+	// ConditionStorageReady is true when the data volume claims of the H2 instances are bound
+	ConditionStorageReady status.ConditionType = "StorageReady"
+	// ConditionPaused is true while the operator leaves the database alone, as requested by the paused annotation
+	ConditionPaused status.ConditionType = "Paused"
+	// ConditionUpgrading is true while the data is migrated to a new image
+	ConditionUpgrading status.ConditionType = "Upgrading"
+	// ConditionMaintenance is true while the H2 pods are taken out of the Service, as requested by the maintenance annotation
+	ConditionMaintenance status.ConditionType = "Maintenance"
+)
+
+// H2DatabaseStatus defines the observed state of H2Database
+// +k8s:openapi-gen=true
+type H2DatabaseStatus struct {
+	// ObservedGeneration is the most recent generation of the spec handled by the operator
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Phase is a summary of the state of the database
+	// +optional
+	Phase H2DatabasePhase `json:"phase,omitempty"`
+
+	// Conditions are the latest observations of the state of the database
+	// +optional
+	Conditions status.Conditions `json:"conditions,omitempty"`
+
+	// Nodes are the names of the h2 pods
+	// +optional
+	Nodes []string `json:"nodes,omitempty"`
+
+	// Replicas is the number of H2 pods, used by the scale subresource
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// ReadyReplicas is the number of available H2 pods
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// Selector is the label selector of the H2 pods, used by the scale subresource
+	// +optional
+	Selector string `json:"selector,omitempty"`
+
+	// ClusterState is the state of the H2 cluster
+	// +optional
+	ClusterState ClusterState `json:"clusterState,omitempty"`
+
+	// LastBackupHash identifies the backup section of the spec the last backup was taken for
+	// +optional
+	LastBackupHash string `json:"lastBackupHash,omitempty"`
+
+	// LastBackupURL is the URL the last backup was posted to, with its password and query hidden
+	// +optional
+	LastBackupURL string `json:"lastBackupURL,omitempty"`
+
+	// LastBackupTime is when the last backup was posted
+	// +optional
+	LastBackupTime *metav1.Time `json:"lastBackupTime,omitempty"`
+
+	// CredentialsSecret is the name of the Secret holding the admin credentials of the database
+	// +optional
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+
+	// Binding refers to the Secret with the connection details of the database,
+	// as required by the Service Binding for Kubernetes spec
+	// +optional
+	Binding *corev1.LocalObjectReference `json:"binding,omitempty"`
+
+	// CABundle is the name of the ConfigMap holding, under the 'ca.crt' key, the CA certificates
+	// clients use to verify the H2 TCP server when TLS is enabled
+	// +optional
+	CABundle string `json:"caBundle,omitempty"`
+
+	// CertificateNotAfter is when the serving certificate of the H2 TCP server expires
+	// +optional
+	CertificateNotAfter *metav1.Time `json:"certificateNotAfter,omitempty"`
+
+	// Image is the image the data directory has been written with
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// DataSubPath is the directory of the data volume holding the H2 data directory, the root of the volume when empty.
+	// Every migration of the data to a new image imports it into a directory of its own.
+	// +optional
+	DataSubPath string `json:"dataSubPath,omitempty"`
+
+	// Upgrade is the progress of the last migration of the data to a new image
+	// +optional
+	Upgrade *H2DatabaseUpgradeStatus `json:"upgrade,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// H2Database is the Schema for the h2databases API
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.size,statuspath=.status.replicas,selectorpath=.status.selector
+// +kubebuilder:resource:path=h2databases,scope=Namespaced
+// +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Size",type="integer",JSONPath=".spec.size",description="Desired number of H2 instances"
+// +kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.readyReplicas",description="Number of available H2 instances"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".status.clusterState",description="State of the H2 cluster"
+// +kubebuilder:printcolumn:name="Last Backup",type="date",JSONPath=".status.lastBackupTime",description="When the last backup was posted"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type H2Database struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   H2DatabaseSpec   `json:"spec,omitempty"`
+	Status H2DatabaseStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// H2DatabaseList contains a list of H2Database
+type H2DatabaseList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []H2Database `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&H2Database{}, &H2DatabaseList{})
+}
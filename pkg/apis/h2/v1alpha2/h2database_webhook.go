@@ -0,0 +1,159 @@
+package v1alpha2
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// Defaults applied to H2Database specs. They are mirrored by the +kubebuilder:default
+// markers in h2database_types.go, so keep both in sync.
+const (
+	DefaultSize        int32 = 1
+	DefaultImage             = "oscarfonts/h2:alpine"
+	DefaultCacheSize   int32 = 16384
+	DefaultStorageSize       = "1Gi"
+	DefaultDatabase          = "h2"
+	DefaultRunAsUser   int64 = 1000
+	DefaultFSGroup     int64 = 1000
+	// DefaultMetricsInterval is the scrape interval of the ServiceMonitors
+	DefaultMetricsInterval = "30s"
+	DefaultDeletionPolicy  = DeletionPolicyDelete
+	DefaultUpgradeStrategy = UpgradeStrategyMigrate
+)
+
+var h2databaselog = logf.Log.WithName("h2database-resource")
+
+// SetupWebhookWithManager registers the H2Database webhooks with the manager's webhook server
+func (r *H2Database) SetupWebhookWithManager(mgr manager.Manager) error {
+	return builder.WebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-h2-example-com-v1alpha2-h2database,mutating=true,failurePolicy=fail,groups=h2.example.com,resources=h2databases,verbs=create;update,versions=v1alpha2,name=mh2database.v1alpha2.kb.io
+
+var _ webhook.Defaulter = &H2Database{}
+
+// Default fills in the unset fields of the spec. It is called by the mutating webhook,
+// and by the controller so that objects admitted without the webhook behave the same.
+func (r *H2Database) Default() {
+	h2databaselog.V(1).Info("default", "name", r.Name)
+
+	if r.Spec.Size == nil {
+		size := DefaultSize
+		r.Spec.Size = &size
+	}
+	if r.Spec.Image == "" {
+		r.Spec.Image = DefaultImage
+	}
+	if r.Spec.CacheSize == 0 {
+		r.Spec.CacheSize = DefaultCacheSize
+	}
+	if r.Spec.Storage.Size.IsZero() {
+		r.Spec.Storage.Size = resource.MustParse(DefaultStorageSize)
+	}
+	if len(r.Spec.ServerModes) == 0 {
+		r.Spec.ServerModes = []H2ServerMode{ServerModeTCP}
+	}
+	if r.Spec.Database == "" {
+		r.Spec.Database = DefaultDatabase
+	}
+	if r.Spec.Service.Type == "" {
+		r.Spec.Service.Type = corev1.ServiceTypeClusterIP
+	}
+	if r.Spec.SecurityContext.RunAsUser == nil && !r.Spec.SecurityContext.AllowRoot {
+		uid := DefaultRunAsUser
+		r.Spec.SecurityContext.RunAsUser = &uid
+	}
+	if r.Spec.SecurityContext.FSGroup == nil {
+		gid := DefaultFSGroup
+		r.Spec.SecurityContext.FSGroup = &gid
+	}
+	if r.Spec.Metrics.Interval == "" {
+		r.Spec.Metrics.Interval = DefaultMetricsInterval
+	}
+	if r.Spec.DeletionPolicy == "" {
+		r.Spec.DeletionPolicy = DefaultDeletionPolicy
+	}
+	if r.Spec.Upgrade.Strategy == "" {
+		r.Spec.Upgrade.Strategy = DefaultUpgradeStrategy
+	}
+}
+
+// +kubebuilder:webhook:path=/validate-h2-example-com-v1alpha2-h2database,mutating=false,failurePolicy=fail,groups=h2.example.com,resources=h2databases,verbs=update,versions=v1alpha2,name=vh2database.v1alpha2.kb.io
+
+var _ webhook.Validator = &H2Database{}
+
+// ValidateCreate lets every H2Database be created, the spec is checked by the CRD schema
+func (r *H2Database) ValidateCreate() error {
+	return nil
+}
+
+// ValidateUpdate rejects the image changes that would leave the data unreadable, it is called by the validating webhook
+func (r *H2Database) ValidateUpdate(old runtime.Object) error {
+	h2databaselog.V(1).Info("validate update", "name", r.Name)
+	previous, ok := old.(*H2Database)
+	if !ok || r.Spec.Upgrade.Strategy != UpgradeStrategyInPlace || previous.Spec.Image == r.Spec.Image {
+		return nil
+	}
+	// The data files written by a major version of H2 cannot be opened by another one
+	from, fromOK := imageMajorVersion(previous.Spec.Image)
+	to, toOK := imageMajorVersion(r.Spec.Image)
+	if fromOK && toOK && from == to {
+		return nil
+	}
+	errs := field.ErrorList{field.Forbidden(field.NewPath("spec", "image"), fmt.Sprintf(
+		"the H2 major versions of %s and %s differ or cannot be told from the tags, the InPlace strategy would leave the data unreadable, set spec.upgrade.strategy to Migrate",
+		previous.Spec.Image, r.Spec.Image))}
+	return apierrors.NewInvalid(SchemeGroupVersion.WithKind("H2Database").GroupKind(), r.Name, errs)
+}
+
+// ValidateDelete lets every H2Database be deleted
+func (r *H2Database) ValidateDelete() error {
+	return nil
+}
+
+// imageMajorVersion returns the major version of H2 the tag of the image starts with,
+// e.g. 2 for oscarfonts/h2:2.1.214, or false if the tag doesn't start with a version, e.g. for oscarfonts/h2:alpine
+func imageMajorVersion(image string) (string, bool) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return "", false
+	}
+	tag := image[i+1:]
+	end := 0
+	for end < len(tag) && tag[end] >= '0' && tag[end] <= '9' {
+		end++
+	}
+	if end == 0 || (end < len(tag) && tag[end] != '.') {
+		return "", false
+	}
+	return tag[:end], true
+}
+
+// HasServerMode returns true if the given H2 server is enabled in the spec,
+// the web server is also enabled by the console section
+func (r *H2Database) HasServerMode(mode H2ServerMode) bool {
+	if mode == ServerModeWeb && r.Spec.Console.Enabled {
+		return true
+	}
+	for _, m := range r.Spec.ServerModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
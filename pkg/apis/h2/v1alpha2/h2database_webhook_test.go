@@ -0,0 +1,41 @@
+package v1alpha2
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateUpdateImage(t *testing.T) {
+	tests := []struct {
+		from, to string
+		strategy H2DatabaseUpgradeStrategy
+		valid    bool
+	}{
+		{"oscarfonts/h2:1.4.200", "oscarfonts/h2:2.1.214", UpgradeStrategyMigrate, true},
+		{"oscarfonts/h2:2.1.210", "oscarfonts/h2:2.1.214", UpgradeStrategyInPlace, true},
+		{"registry:5000/h2:2.1.210", "registry:5000/h2:2.1.214-alpine@sha256:0123", UpgradeStrategyInPlace, true},
+		{"oscarfonts/h2:1.4.200", "oscarfonts/h2:2.1.214", UpgradeStrategyInPlace, false},
+		{"oscarfonts/h2:alpine", "oscarfonts/h2:2.1.214", UpgradeStrategyInPlace, false},
+		{"registry:5000/h2", "registry:5000/h2:2.1.214", UpgradeStrategyInPlace, false},
+	}
+	for _, tt := range tests {
+		old := &H2Database{ObjectMeta: metav1.ObjectMeta{Name: "example"}}
+		old.Spec.Image = tt.from
+		old.Default()
+		h := old.DeepCopy()
+		h.Spec.Image = tt.to
+		h.Spec.Upgrade.Strategy = tt.strategy
+		if err := h.ValidateUpdate(old); (err == nil) != tt.valid {
+			t.Errorf("Unexpected validation of the %s change from %s to %s: %v", tt.strategy, tt.from, tt.to, err)
+		}
+	}
+}
+
+func TestDefaultUpgradeStrategyMigrates(t *testing.T) {
+	h := &H2Database{}
+	h.Default()
+	if h.Spec.Upgrade.Strategy != UpgradeStrategyMigrate {
+		t.Errorf("Expected image changes to migrate the data by default, got %s", h.Spec.Upgrade.Strategy)
+	}
+}
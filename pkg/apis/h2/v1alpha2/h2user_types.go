@@ -0,0 +1,136 @@
+package v1alpha2
+
+import (
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
+
+// H2UserSpec defines the desired state of H2User
+// +k8s:openapi-gen=true
+type H2UserSpec struct {
+	// Database is the name of the H2Database in the same namespace the user is created in
+	Database string `json:"database"`
+
+	// Username of the database user, H2 stores it upper-cased
+	// +kubebuilder:validation:Pattern=`^[A-Za-z][A-Za-z0-9_]*$`
+	Username string `json:"username"`
+
+	// PasswordSecret is the name of a Secret in the same namespace with a 'password' key.
+	// The operator generates the Secret if it does not exist.
+	PasswordSecret string `json:"passwordSecret"`
+
+	// Admin gives the user admin rights on the database
+	// +optional
+	Admin bool `json:"admin,omitempty"`
+
+	// Grants are the privileges of the user, grants removed from the list are revoked
+	// +optional
+	Grants []H2Grant `json:"grants,omitempty"`
+
+	// Rotation makes the operator generate a new password periodically.
+	// A rotation can also be triggered by changing the h2.example.com/rotate-password annotation.
+	// +optional
+	Rotation *H2PasswordRotation `json:"rotation,omitempty"`
+}
+
+// H2PasswordRotation defines how often the password of a user is rotated
+type H2PasswordRotation struct {
+	// Interval between two rotations, e.g. "720h", counted from the time the password was set in the database
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// GracePeriod is how long the next password is published in the Secret under the 'next-password' key
+	// before it replaces the current one in the database, so that consumers can pick it up beforehand.
+	// NOTE: A H2 user has a single password, the current one stops working once the next one is set.
+	// +kubebuilder:default="1h"
+	// +optional
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+}
+
+// H2Grant is a set of privileges on a schema or a table
+type H2Grant struct {
+	// Schema the privileges apply to
+	// +kubebuilder:validation:Pattern=`^[A-Za-z][A-Za-z0-9_]*$`
+	// +kubebuilder:default="PUBLIC"
+	// +optional
+	Schema string `json:"schema,omitempty"`
+
+	// Table the privileges apply to, all tables of the schema if empty
+	// +kubebuilder:validation:Pattern=`^[A-Za-z][A-Za-z0-9_]*$`
+	// +optional
+	Table string `json:"table,omitempty"`
+
+	// Privileges granted on the schema or table
+	// +kubebuilder:validation:MinItems=1
+	Privileges []H2Privilege `json:"privileges"`
+}
+
+// H2Privilege is a privilege H2 can grant on a schema or a table
+// +kubebuilder:validation:Enum=SELECT;INSERT;UPDATE;DELETE;ALL
+type H2Privilege string
+
+// Condition types reported in the H2User status
+const (
+	// ConditionUserReady is true when the user and its grants have been applied to the database
+	ConditionUserReady status.ConditionType = "Ready"
+)
+
+// H2UserStatus defines the observed state of H2User
+// +k8s:openapi-gen=true
+type H2UserStatus struct {
+	// ObservedGeneration is the most recent generation of the spec handled by the operator
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// AppliedHash identifies the spec and password last applied to the database
+	// +optional
+	AppliedHash string `json:"appliedHash,omitempty"`
+
+	// Grants are the grants last applied to the database, used to revoke removed grants
+	// +optional
+	Grants []H2Grant `json:"grants,omitempty"`
+
+	// LastRotationTime is when a password rotated by the operator was last set in the database
+	// +optional
+	LastRotationTime *metav1.Time `json:"lastRotationTime,omitempty"`
+
+	// Conditions are the latest observations of the state of the user
+	// +optional
+	Conditions status.Conditions `json:"conditions,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// H2User is the Schema for the h2users API
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=h2users,scope=Namespaced
+// +kubebuilder:printcolumn:name="Database",type="string",JSONPath=".spec.database"
+// +kubebuilder:printcolumn:name="Username",type="string",JSONPath=".spec.username"
+// +kubebuilder:printcolumn:name="Admin",type="boolean",JSONPath=".spec.admin"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Last Rotation",type="date",JSONPath=".status.lastRotationTime"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type H2User struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   H2UserSpec   `json:"spec,omitempty"`
+	Status H2UserStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// H2UserList contains a list of H2User
+type H2UserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []H2User `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&H2User{}, &H2UserList{})
+}
@@ -0,0 +1,658 @@
+// +build !ignore_autogenerated
+
+// Code generated by operator-sdk. DO NOT EDIT.
+
+package v1alpha2
+
+import (
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2Database) DeepCopyInto(out *H2Database) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2Database.
+func (in *H2Database) DeepCopy() *H2Database {
+	if in == nil {
+		return nil
+	}
+	out := new(H2Database)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *H2Database) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseBackup) DeepCopyInto(out *H2DatabaseBackup) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseBackup.
+func (in *H2DatabaseBackup) DeepCopy() *H2DatabaseBackup {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseBackup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseBinding) DeepCopyInto(out *H2DatabaseBinding) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseBinding.
+func (in *H2DatabaseBinding) DeepCopy() *H2DatabaseBinding {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseBinding)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseClustering) DeepCopyInto(out *H2DatabaseClustering) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseClustering.
+func (in *H2DatabaseClustering) DeepCopy() *H2DatabaseClustering {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseClustering)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseConsole) DeepCopyInto(out *H2DatabaseConsole) {
+	*out = *in
+	if in.Ingress != nil {
+		in, out := &in.Ingress, &out.Ingress
+		*out = new(H2DatabaseConsoleIngress)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseConsole.
+func (in *H2DatabaseConsole) DeepCopy() *H2DatabaseConsole {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseConsole)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseConsoleIngress) DeepCopyInto(out *H2DatabaseConsoleIngress) {
+	*out = *in
+	if in.IngressClassName != nil {
+		in, out := &in.IngressClassName, &out.IngressClassName
+		*out = new(string)
+		**out = **in
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseConsoleIngress.
+func (in *H2DatabaseConsoleIngress) DeepCopy() *H2DatabaseConsoleIngress {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseConsoleIngress)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseCredentials) DeepCopyInto(out *H2DatabaseCredentials) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseCredentials.
+func (in *H2DatabaseCredentials) DeepCopy() *H2DatabaseCredentials {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseCredentials)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseList) DeepCopyInto(out *H2DatabaseList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]H2Database, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseList.
+func (in *H2DatabaseList) DeepCopy() *H2DatabaseList {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *H2DatabaseList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseMetrics) DeepCopyInto(out *H2DatabaseMetrics) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseMetrics.
+func (in *H2DatabaseMetrics) DeepCopy() *H2DatabaseMetrics {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseMetrics)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseNetworkPolicy) DeepCopyInto(out *H2DatabaseNetworkPolicy) {
+	*out = *in
+	if in.From != nil {
+		in, out := &in.From, &out.From
+		*out = make([]v1.NetworkPolicyPeer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseNetworkPolicy.
+func (in *H2DatabaseNetworkPolicy) DeepCopy() *H2DatabaseNetworkPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseNetworkPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseNodePorts) DeepCopyInto(out *H2DatabaseNodePorts) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseNodePorts.
+func (in *H2DatabaseNodePorts) DeepCopy() *H2DatabaseNodePorts {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseNodePorts)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseProbe) DeepCopyInto(out *H2DatabaseProbe) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseProbe.
+func (in *H2DatabaseProbe) DeepCopy() *H2DatabaseProbe {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseProbe)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseProbes) DeepCopyInto(out *H2DatabaseProbes) {
+	*out = *in
+	out.Startup = in.Startup
+	out.Readiness = in.Readiness
+	out.Liveness = in.Liveness
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseProbes.
+func (in *H2DatabaseProbes) DeepCopy() *H2DatabaseProbes {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseProbes)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseSecurityContext) DeepCopyInto(out *H2DatabaseSecurityContext) {
+	*out = *in
+	if in.RunAsUser != nil {
+		in, out := &in.RunAsUser, &out.RunAsUser
+		*out = new(int64)
+		**out = **in
+	}
+	if in.FSGroup != nil {
+		in, out := &in.FSGroup, &out.FSGroup
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseSecurityContext.
+func (in *H2DatabaseSecurityContext) DeepCopy() *H2DatabaseSecurityContext {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseSecurityContext)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseService) DeepCopyInto(out *H2DatabaseService) {
+	*out = *in
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	out.NodePorts = in.NodePorts
+	if in.LoadBalancerSourceRanges != nil {
+		in, out := &in.LoadBalancerSourceRanges, &out.LoadBalancerSourceRanges
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseService.
+func (in *H2DatabaseService) DeepCopy() *H2DatabaseService {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseService)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseSpec) DeepCopyInto(out *H2DatabaseSpec) {
+	*out = *in
+	if in.Size != nil {
+		in, out := &in.Size, &out.Size
+		*out = new(int32)
+		**out = **in
+	}
+	in.Storage.DeepCopyInto(&out.Storage)
+	if in.ServerModes != nil {
+		in, out := &in.ServerModes, &out.ServerModes
+		*out = make([]H2ServerMode, len(*in))
+		copy(*out, *in)
+	}
+	out.Clustering = in.Clustering
+	out.Backup = in.Backup
+	out.Credentials = in.Credentials
+	out.TLS = in.TLS
+	in.NetworkPolicy.DeepCopyInto(&out.NetworkPolicy)
+	in.SecurityContext.DeepCopyInto(&out.SecurityContext)
+	out.Binding = in.Binding
+	in.Console.DeepCopyInto(&out.Console)
+	in.Service.DeepCopyInto(&out.Service)
+	out.Probes = in.Probes
+	out.Metrics = in.Metrics
+	out.Upgrade = in.Upgrade
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseSpec.
+func (in *H2DatabaseSpec) DeepCopy() *H2DatabaseSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseStatus) DeepCopyInto(out *H2DatabaseStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(status.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastBackupTime != nil {
+		in, out := &in.LastBackupTime, &out.LastBackupTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Binding != nil {
+		in, out := &in.Binding, &out.Binding
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.CertificateNotAfter != nil {
+		in, out := &in.CertificateNotAfter, &out.CertificateNotAfter
+		*out = (*in).DeepCopy()
+	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(H2DatabaseUpgradeStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseStatus.
+func (in *H2DatabaseStatus) DeepCopy() *H2DatabaseStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseStorage) DeepCopyInto(out *H2DatabaseStorage) {
+	*out = *in
+	out.Size = in.Size.DeepCopy()
+	if in.StorageClassName != nil {
+		in, out := &in.StorageClassName, &out.StorageClassName
+		*out = new(string)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseStorage.
+func (in *H2DatabaseStorage) DeepCopy() *H2DatabaseStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseTLS) DeepCopyInto(out *H2DatabaseTLS) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseTLS.
+func (in *H2DatabaseTLS) DeepCopy() *H2DatabaseTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseUpgrade) DeepCopyInto(out *H2DatabaseUpgrade) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseUpgrade.
+func (in *H2DatabaseUpgrade) DeepCopy() *H2DatabaseUpgrade {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseUpgrade)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2DatabaseUpgradeStatus) DeepCopyInto(out *H2DatabaseUpgradeStatus) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2DatabaseUpgradeStatus.
+func (in *H2DatabaseUpgradeStatus) DeepCopy() *H2DatabaseUpgradeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(H2DatabaseUpgradeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2Grant) DeepCopyInto(out *H2Grant) {
+	*out = *in
+	if in.Privileges != nil {
+		in, out := &in.Privileges, &out.Privileges
+		*out = make([]H2Privilege, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2Grant.
+func (in *H2Grant) DeepCopy() *H2Grant {
+	if in == nil {
+		return nil
+	}
+	out := new(H2Grant)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2PasswordRotation) DeepCopyInto(out *H2PasswordRotation) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.GracePeriod != nil {
+		in, out := &in.GracePeriod, &out.GracePeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2PasswordRotation.
+func (in *H2PasswordRotation) DeepCopy() *H2PasswordRotation {
+	if in == nil {
+		return nil
+	}
+	out := new(H2PasswordRotation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2User) DeepCopyInto(out *H2User) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2User.
+func (in *H2User) DeepCopy() *H2User {
+	if in == nil {
+		return nil
+	}
+	out := new(H2User)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *H2User) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2UserList) DeepCopyInto(out *H2UserList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]H2User, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2UserList.
+func (in *H2UserList) DeepCopy() *H2UserList {
+	if in == nil {
+		return nil
+	}
+	out := new(H2UserList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *H2UserList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2UserSpec) DeepCopyInto(out *H2UserSpec) {
+	*out = *in
+	if in.Grants != nil {
+		in, out := &in.Grants, &out.Grants
+		*out = make([]H2Grant, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Rotation != nil {
+		in, out := &in.Rotation, &out.Rotation
+		*out = new(H2PasswordRotation)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2UserSpec.
+func (in *H2UserSpec) DeepCopy() *H2UserSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(H2UserSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *H2UserStatus) DeepCopyInto(out *H2UserStatus) {
+	*out = *in
+	if in.Grants != nil {
+		in, out := &in.Grants, &out.Grants
+		*out = make([]H2Grant, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastRotationTime != nil {
+		in, out := &in.LastRotationTime, &out.LastRotationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(status.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new H2UserStatus.
+func (in *H2UserStatus) DeepCopy() *H2UserStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(H2UserStatus)
+	in.DeepCopyInto(out)
+	return out
+}
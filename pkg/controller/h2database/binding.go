@@ -0,0 +1,97 @@
+package h2database
+
+import (
+	"context"
+	"fmt"
+
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Binding entries, see https://github.com/servicebinding/spec#well-known-secret-entries
+const (
+	bindingTypeKey     = "type"
+	bindingProviderKey = "provider"
+	bindingHostKey     = "host"
+	bindingPortKey     = "port"
+	bindingDatabaseKey = "database"
+	bindingJDBCURLKey  = "jdbcUrl"
+	bindingPGURLKey    = "pgUrl"
+	bindingUsernameKey = "username"
+	bindingPasswordKey = "password"
+
+	bindingType     = "h2"
+	bindingProvider = "h2.example.com"
+)
+
+// bindingName returns the name of the Secret and ConfigMap with the connection details of the given H2 CR
+func bindingName(h *h2v1alpha2.H2Database) string {
+	return h.Name + "-binding"
+}
+
+// bindingDataForH2Database returns the connection details of the given H2 CR, without the credentials.
+// Only the servers enabled in the spec are published: the port is the one of the TCP server, or of the PG
+// server when it runs alone, and is left out along with the URLs when neither runs.
+func bindingDataForH2Database(h *h2v1alpha2.H2Database) map[string]string {
+	host := fmt.Sprintf("%s.%s.svc", h.Name, h.Namespace)
+	data := map[string]string{
+		bindingTypeKey:     bindingType,
+		bindingProviderKey: bindingProvider,
+		bindingHostKey:     host,
+		bindingDatabaseKey: h.Spec.Database,
+	}
+	if h.HasServerMode(h2v1alpha2.ServerModePG) {
+		data[bindingPortKey] = fmt.Sprint(h2PGPort)
+		data[bindingPGURLKey] = fmt.Sprintf("jdbc:postgresql://%s:%d/%s", host, h2PGPort, h.Spec.Database)
+	}
+	if h.HasServerMode(h2v1alpha2.ServerModeTCP) {
+		data[bindingPortKey] = fmt.Sprint(h2TCPPort)
+		data[bindingJDBCURLKey] = jdbcURL(host, h)
+	}
+	return data
+}
+
+// reconcileBinding publishes the connection details of the given H2 CR along with the admin credentials
+// in the binding Secret, and without them in the binding ConfigMap if requested
+func (r *ReconcileH2Database) reconcileBinding(h *h2v1alpha2.H2Database, credentials *corev1.Secret) error {
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name)
+
+	sec := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: bindingName(h), Namespace: h.Namespace}}
+	op, err := controllerutil.CreateOrUpdate(context.TODO(), r.client, sec, func() error {
+		sec.Labels = labelsForH2Database(h.Name)
+		sec.Type = corev1.SecretType("servicebinding.io/" + bindingType)
+		sec.Data = map[string][]byte{
+			bindingUsernameKey: credentials.Data[credentialsUsernameKey],
+			bindingPasswordKey: credentials.Data[credentialsPasswordKey],
+		}
+		for k, v := range bindingDataForH2Database(h) {
+			sec.Data[k] = []byte(v)
+		}
+		return controllerutil.SetControllerReference(h, sec, r.scheme)
+	})
+	if err != nil {
+		reqLogger.Error(err, "Failed to ensure the binding Secret.", "Secret.Namespace", sec.Namespace, "Secret.Name", sec.Name)
+		return err
+	}
+	if op != controllerutil.OperationResultNone {
+		reqLogger.Info("Published the connection details.", "Secret.Namespace", sec.Namespace, "Secret.Name", sec.Name, "Operation", op)
+	}
+	h.Status.Binding = &corev1.LocalObjectReference{Name: sec.Name}
+
+	if !h.Spec.Binding.ConfigMap {
+		return r.deleteOwned(h, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: bindingName(h), Namespace: h.Namespace}})
+	}
+
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: bindingName(h), Namespace: h.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(context.TODO(), r.client, cm, func() error {
+		cm.Labels = labelsForH2Database(h.Name)
+		cm.Data = bindingDataForH2Database(h)
+		return controllerutil.SetControllerReference(h, cm, r.scheme)
+	})
+	if err != nil {
+		reqLogger.Error(err, "Failed to ensure the binding ConfigMap.", "ConfigMap.Namespace", cm.Namespace, "ConfigMap.Name", cm.Name)
+	}
+	return err
+}
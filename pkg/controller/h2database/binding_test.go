@@ -0,0 +1,57 @@
+package h2database
+
+import (
+	"reflect"
+	"testing"
+
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBindingDataForH2Database(t *testing.T) {
+	tests := []struct {
+		name  string
+		modes []h2v1alpha2.H2ServerMode
+		tls   bool
+		want  map[string]string
+	}{
+		{"tcp", []h2v1alpha2.H2ServerMode{h2v1alpha2.ServerModeTCP}, false, map[string]string{
+			bindingPortKey:    "1521",
+			bindingJDBCURLKey: "jdbc:h2:tcp://example.default.svc:1521/h2",
+		}},
+		{"tcp with tls", []h2v1alpha2.H2ServerMode{h2v1alpha2.ServerModeTCP}, true, map[string]string{
+			bindingPortKey:    "1521",
+			bindingJDBCURLKey: "jdbc:h2:ssl://example.default.svc:1521/h2",
+		}},
+		{"tcp and pg", []h2v1alpha2.H2ServerMode{h2v1alpha2.ServerModePG, h2v1alpha2.ServerModeTCP}, false, map[string]string{
+			bindingPortKey:    "1521",
+			bindingJDBCURLKey: "jdbc:h2:tcp://example.default.svc:1521/h2",
+			bindingPGURLKey:   "jdbc:postgresql://example.default.svc:5435/h2",
+		}},
+		{"pg", []h2v1alpha2.H2ServerMode{h2v1alpha2.ServerModePG}, false, map[string]string{
+			bindingPortKey:  "5435",
+			bindingPGURLKey: "jdbc:postgresql://example.default.svc:5435/h2",
+		}},
+		{"web", []h2v1alpha2.H2ServerMode{h2v1alpha2.ServerModeWeb}, false, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &h2v1alpha2.H2Database{ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"}}
+			h.Spec.Database = "h2"
+			h.Spec.ServerModes = tt.modes
+			h.Spec.TLS.Enabled = tt.tls
+			want := map[string]string{
+				bindingTypeKey:     bindingType,
+				bindingProviderKey: bindingProvider,
+				bindingHostKey:     "example.default.svc",
+				bindingDatabaseKey: "h2",
+			}
+			for k, v := range tt.want {
+				want[k] = v
+			}
+			if got := bindingDataForH2Database(h); !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected %v, got %v", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package h2database
+
+import (
+	"context"
+
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// consolePasswordKey is the key of the console admin password in its Secret
+const consolePasswordKey = "password"
+
+// ingressGVK is the Ingress API served by current clusters
+// NOTE: The Kubernetes API this operator is built against only has the deprecated v1beta1 Ingress,
+// so the Ingress is handled as an unstructured object.
+var ingressGVK = schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"}
+
+// consoleName returns the name of the Service, Ingress and generated Secret of the console of the given H2 CR
+func consoleName(h *h2v1alpha2.H2Database) string {
+	return h.Name + "-console"
+}
+
+// consoleSecretName returns the name of the Secret holding the console admin password of the given H2 CR
+func consoleSecretName(h *h2v1alpha2.H2Database) string {
+	if h.Spec.Console.AdminPasswordSecret != "" {
+		return h.Spec.Console.AdminPasswordSecret
+	}
+	return consoleName(h)
+}
+
+// consoleEnvForH2Database returns the environment variable exposing the console admin password
+// to the H2 container as $H2_CONSOLE_PASSWORD
+func consoleEnvForH2Database(h *h2v1alpha2.H2Database) []corev1.EnvVar {
+	if !h.Spec.Console.Enabled {
+		return nil
+	}
+	return []corev1.EnvVar{{
+		Name: "H2_CONSOLE_PASSWORD",
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: consoleSecretName(h)},
+				Key:                  consolePasswordKey,
+			},
+		},
+	}}
+}
+
+// reconcileConsole makes sure the console admin password Secret, the console Service and the console Ingress
+// of the given H2 CR match the spec, and deletes the Service and the Ingress when the console is disabled.
+// It returns false if the Secret supplied by the user does not exist yet.
+func (r *ReconcileH2Database) reconcileConsole(h *h2v1alpha2.H2Database) (bool, error) {
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name)
+
+	ingress := &unstructured.Unstructured{}
+	ingress.SetGroupVersionKind(ingressGVK)
+	ingress.SetName(consoleName(h))
+	ingress.SetNamespace(h.Namespace)
+
+	if !h.Spec.Console.Enabled {
+		if err := r.deleteOwned(h, &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: consoleName(h), Namespace: h.Namespace}}); err != nil {
+			return false, err
+		}
+		return true, r.deleteOwned(h, ingress)
+	}
+
+	// Check if the console admin password Secret already exists, if not generate a new one
+	sec := &corev1.Secret{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: consoleSecretName(h), Namespace: h.Namespace}, sec)
+	if err != nil && errors.IsNotFound(err) {
+		if h.Spec.Console.AdminPasswordSecret != "" {
+			reqLogger.Info("Waiting for the console Secret to be created.", "Secret.Namespace", h.Namespace, "Secret.Name", h.Spec.Console.AdminPasswordSecret)
+			r.recorder.Eventf(h, corev1.EventTypeWarning, eventReasonSecretMissing, "Waiting for the console Secret %s", h.Spec.Console.AdminPasswordSecret)
+			return false, nil
+		}
+		password, err := generatePassword()
+		if err != nil {
+			reqLogger.Error(err, "Failed to generate the console password.")
+			return false, err
+		}
+		sec = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      consoleSecretName(h),
+				Namespace: h.Namespace,
+				Labels:    labelsForH2Database(h.Name),
+			},
+			Type:       corev1.SecretTypeOpaque,
+			StringData: map[string]string{consolePasswordKey: password},
+		}
+		controllerutil.SetControllerReference(h, sec, r.scheme)
+		reqLogger.Info("Creating a new console Secret.", "Secret.Namespace", sec.Namespace, "Secret.Name", sec.Name)
+		if err := r.client.Create(context.TODO(), sec); err != nil {
+			reqLogger.Error(err, "Failed to create new console Secret.", "Secret.Namespace", sec.Namespace, "Secret.Name", sec.Name)
+			return false, err
+		}
+	} else if err != nil {
+		reqLogger.Error(err, "Failed to get console Secret.")
+		return false, err
+	}
+
+	ser := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: consoleName(h), Namespace: h.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(context.TODO(), r.client, ser, func() error {
+		ser.Labels = labelsForH2Database(h.Name)
+		ser.Spec.Selector = labelsForH2Database(h.Name)
+		// The defaulted fields are set explicitly, so that the Service is not updated every time
+		ser.Spec.Ports = []corev1.ServicePort{{
+			Name:       "web",
+			Protocol:   corev1.ProtocolTCP,
+			Port:       h2WebPort,
+			TargetPort: intstr.FromInt(int(h2WebPort)),
+		}}
+		return controllerutil.SetControllerReference(h, ser, r.scheme)
+	})
+	if err != nil {
+		reqLogger.Error(err, "Failed to ensure the console Service.", "Service.Namespace", ser.Namespace, "Service.Name", ser.Name)
+		return false, err
+	}
+
+	if h.Spec.Console.Ingress == nil {
+		return true, r.deleteOwned(h, ingress)
+	}
+	_, err = controllerutil.CreateOrUpdate(context.TODO(), r.client, ingress, func() error {
+		ingress.SetLabels(labelsForH2Database(h.Name))
+		ingress.SetAnnotations(h.Spec.Console.Ingress.Annotations)
+		ingress.Object["spec"] = consoleIngressSpec(h)
+		return controllerutil.SetControllerReference(h, ingress, r.scheme)
+	})
+	if err != nil {
+		reqLogger.Error(err, "Failed to ensure the console Ingress.", "Ingress.Namespace", h.Namespace, "Ingress.Name", consoleName(h))
+		return false, err
+	}
+	return true, nil
+}
+
+// consoleIngressSpec returns the spec of the networking.k8s.io/v1 Ingress routing the console host to the console Service
+func consoleIngressSpec(h *h2v1alpha2.H2Database) map[string]interface{} {
+	ing := h.Spec.Console.Ingress
+	spec := map[string]interface{}{
+		"rules": []interface{}{
+			map[string]interface{}{
+				"host": ing.Host,
+				"http": map[string]interface{}{
+					"paths": []interface{}{
+						map[string]interface{}{
+							"path":     "/",
+							"pathType": "Prefix",
+							"backend": map[string]interface{}{
+								"service": map[string]interface{}{
+									"name": consoleName(h),
+									"port": map[string]interface{}{"number": int64(h2WebPort)},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if ing.IngressClassName != nil {
+		spec["ingressClassName"] = *ing.IngressClassName
+	}
+	if ing.TLSSecretName != "" {
+		spec["tls"] = []interface{}{
+			map[string]interface{}{
+				"hosts":      []interface{}{ing.Host},
+				"secretName": ing.TLSSecretName,
+			},
+		}
+	}
+	return spec
+}
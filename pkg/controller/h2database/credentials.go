@@ -0,0 +1,87 @@
+package h2database
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Keys of the credentials Secret and the name of the generated admin user
+const (
+	credentialsUsernameKey = "username"
+	credentialsPasswordKey = "password"
+	defaultAdminUsername   = "sa"
+)
+
+// credentialsSecretName returns the name of the Secret holding the admin credentials of the given H2 CR
+func credentialsSecretName(h *h2v1alpha2.H2Database) string {
+	if h.Spec.Credentials.SecretName != "" {
+		return h.Spec.Credentials.SecretName
+	}
+	return h.Name + "-credentials"
+}
+
+// credentialsSecretForH2Database returns a Secret with a generated admin password for the given H2 CR
+func (r *ReconcileH2Database) credentialsSecretForH2Database(h *h2v1alpha2.H2Database) (*corev1.Secret, error) {
+	password, err := generatePassword()
+	if err != nil {
+		return nil, err
+	}
+
+	sec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      credentialsSecretName(h),
+			Namespace: h.Namespace,
+			Labels:    labelsForH2Database(h.Name),
+		},
+		Type: corev1.SecretTypeOpaque,
+		StringData: map[string]string{
+			credentialsUsernameKey: defaultAdminUsername,
+			credentialsPasswordKey: password,
+		},
+	}
+	// Set H2 instance as the owner of the Secret.
+	controllerutil.SetControllerReference(h, sec, r.scheme)
+	return sec, nil
+}
+
+// validateCredentialsSecret checks that the Secret has the keys the H2 pods read the credentials from
+func validateCredentialsSecret(sec *corev1.Secret) error {
+	for _, key := range []string{credentialsUsernameKey, credentialsPasswordKey} {
+		if len(sec.Data[key]) == 0 {
+			return fmt.Errorf("secret %s has no %q key", sec.Name, key)
+		}
+	}
+	return nil
+}
+
+// credentialsEnvForH2Database returns the environment variables exposing the admin credentials
+// to the H2 containers; remote commands refer to them as $H2_USER and $H2_PASSWORD
+func credentialsEnvForH2Database(h *h2v1alpha2.H2Database) []corev1.EnvVar {
+	secretKey := func(key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: credentialsSecretName(h)},
+				Key:                  key,
+			},
+		}
+	}
+	return []corev1.EnvVar{
+		{Name: "H2_USER", ValueFrom: secretKey(credentialsUsernameKey)},
+		{Name: "H2_PASSWORD", ValueFrom: secretKey(credentialsPasswordKey)},
+	}
+}
+
+// generatePassword returns a random password made of URL-safe characters
+func generatePassword() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,223 @@
+package h2database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// deletionFinalizer holds the H2 CRs being deleted until their deletion policy is applied
+const deletionFinalizer = "h2.example.com/deletion-policy"
+
+// retainedAnnotation marks the objects retained by a deleted H2 CR with its UID,
+// only these are adopted by a new H2 CR of the same name
+const retainedAnnotation = "h2.example.com/retained-from"
+
+// finalBackupHash is recorded as the last backup hash once the final backup of the BackupThenDelete policy is posted
+const finalBackupHash = "final"
+
+// deletionRequeueDelay is how long to wait for the final backup to be possible
+const deletionRequeueDelay = 30 * time.Second
+
+// backupCleanupClient sends the DELETE requests to the backup deleteURLs
+var backupCleanupClient = &http.Client{Timeout: 30 * time.Second}
+
+// finalizeH2Database applies the deletion policy of the given H2 CR being deleted, then removes its finalizer.
+// The StatefulSet, the Services and the other dependents are left to the garbage collector.
+func (r *ReconcileH2Database) finalizeH2Database(h *h2v1alpha2.H2Database) (reconcile.Result, error) {
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name, "DeletionPolicy", h.Spec.DeletionPolicy)
+	if !containsString(h.Finalizers, deletionFinalizer) {
+		return reconcile.Result{}, nil
+	}
+
+	switch h.Spec.DeletionPolicy {
+	case h2v1alpha2.DeletionPolicyRetain:
+		// The claims hold the data and the Secret the password of the admin user stored in it
+		claims, err := listDataClaims(r.client, h)
+		if err != nil {
+			reqLogger.Error(err, "Failed to list PersistentVolumeClaims.")
+			return reconcile.Result{}, err
+		}
+		for i := range claims {
+			if err := r.releaseOwned(h, &claims[i]); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+		if h.Spec.Credentials.SecretName == "" {
+			sec := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: credentialsSecretName(h), Namespace: h.Namespace}}
+			if err := r.releaseOwned(h, sec); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+	case h2v1alpha2.DeletionPolicyBackupThenDelete:
+		if h.Status.LastBackupHash != finalBackupHash {
+			if h.Spec.Backup.URL == "" {
+				reqLogger.Info("Waiting for a backup URL to take the final backup.")
+				r.recorder.Event(h, corev1.EventTypeWarning, eventReasonDeletionBlocked,
+					"The BackupThenDelete policy needs spec.backup.url, set it or change the deletion policy")
+				return reconcile.Result{RequeueAfter: deletionRequeueDelay}, nil
+			}
+			pods, err := ListRunningPods(r.client, h)
+			if err != nil {
+				reqLogger.Error(err, "Failed to list pods.")
+				return reconcile.Result{}, err
+			}
+			if len(pods) == 0 {
+				reqLogger.Info("Waiting for a running H2 pod to take the final backup.")
+				r.recorder.Event(h, corev1.EventTypeWarning, eventReasonDeletionBlocked,
+					"Waiting for a running H2 pod to take the final backup, scale the database up or change the deletion policy")
+				return reconcile.Result{RequeueAfter: deletionRequeueDelay}, nil
+			}
+			execErr := r.runBackup(h, &pods[0], finalBackupHash)
+			if err := r.client.Status().Update(context.TODO(), h); err != nil {
+				reqLogger.Error(err, "Failed to update H2Database status.")
+				return reconcile.Result{}, err
+			}
+			if execErr != nil {
+				return requeueAfterRemoteCommand(reconcile.Result{}, nil, execErr)
+			}
+		}
+	default:
+		if h.Spec.Backup.DeleteURL != "" {
+			if err := r.deleteBackups(h); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+	}
+
+	reqLogger.Info("Removing the H2Database finalizer.")
+	controllerutil.RemoveFinalizer(h, deletionFinalizer)
+	err := r.client.Update(context.TODO(), h)
+	if err != nil {
+		reqLogger.Error(err, "Failed to remove the H2Database finalizer.")
+	}
+	return reconcile.Result{}, err
+}
+
+// deleteBackups sends a DELETE request to the backup deleteURL of the given H2 CR
+func (r *ReconcileH2Database) deleteBackups(h *h2v1alpha2.H2Database) error {
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name, "URL", redactURL(h.Spec.Backup.DeleteURL))
+	err := sendDelete(h.Spec.Backup.DeleteURL)
+	if err != nil {
+		reqLogger.Error(err, "Failed to delete the backups.")
+		r.recorder.Eventf(h, corev1.EventTypeWarning, eventReasonBackupCleanupFailed,
+			"Failed to delete the backups at %s, clear spec.backup.deleteURL to keep them: %v", redactURL(h.Spec.Backup.DeleteURL), err)
+		return err
+	}
+	reqLogger.Info("Deleted the backups.")
+	r.recorder.Eventf(h, corev1.EventTypeNormal, eventReasonBackupsDeleted, "Deleted the backups at %s", redactURL(h.Spec.Backup.DeleteURL))
+	return nil
+}
+
+// sendDelete sends a DELETE request to rawURL, backups already gone are fine.
+// NOTE: The errors don't quote the URL, which may hold a signature.
+func sendDelete(rawURL string) error {
+	req, err := http.NewRequest(http.MethodDelete, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid URL")
+	}
+	resp, err := backupCleanupClient.Do(req)
+	if err != nil {
+		if uerr, ok := err.(*url.Error); ok {
+			return uerr.Err
+		}
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+// releaseOwned removes the owner reference to the given H2 CR from the object named like obj,
+// so that it is not garbage collected along with the H2 CR
+func (r *ReconcileH2Database) releaseOwned(h *h2v1alpha2.H2Database, obj runtime.Object) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name, "Object.Type", fmt.Sprintf("%T", obj), "Object.Name", accessor.GetName())
+
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: accessor.GetName(), Namespace: accessor.GetNamespace()}, obj)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		reqLogger.Error(err, "Failed to get the object to retain.")
+		return err
+	}
+	var refs []metav1.OwnerReference
+	for _, ref := range accessor.GetOwnerReferences() {
+		if ref.UID != h.UID {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == len(accessor.GetOwnerReferences()) {
+		return nil
+	}
+	reqLogger.Info("Retaining an object of the deleted H2Database.")
+	accessor.SetOwnerReferences(refs)
+	annotations := accessor.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[retainedAnnotation] = string(h.UID)
+	accessor.SetAnnotations(annotations)
+	err = r.client.Update(context.TODO(), obj)
+	if err != nil {
+		reqLogger.Error(err, "Failed to retain the object.")
+		return err
+	}
+	r.recorder.Eventf(h, corev1.EventTypeNormal, eventReasonRetained, "Retained %s", accessor.GetName())
+	return nil
+}
+
+// adoptRetained makes the given H2 CR the controller of obj if it was retained by a deleted H2 CR,
+// so that the deletion policy applies to it again
+func (r *ReconcileH2Database) adoptRetained(h *h2v1alpha2.H2Database, obj runtime.Object) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	if _, ok := accessor.GetAnnotations()[retainedAnnotation]; !ok || metav1.GetControllerOf(accessor) != nil {
+		return nil
+	}
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name, "Object.Type", fmt.Sprintf("%T", obj), "Object.Name", accessor.GetName())
+	reqLogger.Info("Adopting an object retained by a deleted H2Database.")
+	if err := controllerutil.SetControllerReference(h, accessor, r.scheme); err != nil {
+		return err
+	}
+	annotations := accessor.GetAnnotations()
+	delete(annotations, retainedAnnotation)
+	accessor.SetAnnotations(annotations)
+	err = r.client.Update(context.TODO(), obj)
+	if err != nil {
+		reqLogger.Error(err, "Failed to adopt the object.")
+		return err
+	}
+	r.recorder.Eventf(h, corev1.EventTypeNormal, eventReasonAdopted, "Adopted %s", accessor.GetName())
+	return nil
+}
+
+// containsString returns true if the list holds s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
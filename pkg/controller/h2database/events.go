@@ -0,0 +1,28 @@
+package h2database
+
+// Reasons of the Events recorded on the H2 CRs, besides the ones of the remote commands
+const (
+	eventReasonCreated             = "Created"
+	eventReasonUpdated             = "Updated"
+	eventReasonScaled              = "Scaled"
+	eventReasonBackupStarted       = "BackupStarted"
+	eventReasonBackupSucceeded     = "BackupSucceeded"
+	eventReasonBackupFailed        = "BackupFailed"
+	eventReasonClusterFormed       = "ClusterFormed"
+	eventReasonClusterPending      = "ClusterPending"
+	eventReasonCertificate         = "CertificateIssued"
+	eventReasonSecretMissing       = "SecretMissing"
+	eventReasonInvalidSecret       = "InvalidSecret"
+	eventReasonDeletionBlocked     = "DeletionBlocked"
+	eventReasonRetained            = "Retained"
+	eventReasonAdopted             = "Adopted"
+	eventReasonBackupsDeleted      = "BackupsDeleted"
+	eventReasonBackupCleanupFailed = "BackupCleanupFailed"
+	eventReasonPaused              = "Paused"
+	eventReasonResumed             = "Resumed"
+	eventReasonMaintenance         = "Maintenance"
+	eventReasonUpgradeStarted      = "UpgradeStarted"
+	eventReasonUpgradeExported     = "UpgradeExported"
+	eventReasonUpgradeSucceeded    = "UpgradeSucceeded"
+	eventReasonUpgradeFailed       = "UpgradeFailed"
+)
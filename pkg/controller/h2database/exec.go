@@ -0,0 +1,197 @@
+package h2database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// Reasons of the Events recording the remote commands
+const (
+	eventReasonRemoteCommand       = "RemoteCommand"
+	eventReasonRemoteCommandFailed = "RemoteCommandFailed"
+)
+
+// Operations of the remote commands run for H2Databases, as recorded in the audit log and the failures metric
+const (
+	operationBackup          = "backup"
+	operationCreateCluster   = "create-cluster"
+	operationUpgradeExport   = "upgrade-export"
+	operationUpgradeImport   = "upgrade-import"
+	operationUpgradeCleanup  = "upgrade-cleanup"
+	operationUpgradeTables   = "upgrade-list-tables"
+	operationUpgradeRowCount = "upgrade-count-rows"
+)
+
+// remoteCommandTimeout bounds the duration of a remote command, backups of large databases take a while
+const remoteCommandTimeout = 10 * time.Minute
+
+// remoteCommandBackoff spaces the attempts of a remote command that could not be started
+var remoteCommandBackoff = wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.1, Steps: 3}
+
+// RemoteCommandFailure classifies the failures of the remote commands
+type RemoteCommandFailure string
+
+const (
+	// RemoteCommandConnectionError means the exec stream could not be established, so the command
+	// was not started and it is safe to retry
+	RemoteCommandConnectionError RemoteCommandFailure = "ConnectionError"
+	// RemoteCommandStreamError means the exec stream failed once established, the command may have run
+	// in full or in part, so it is not safe to retry
+	RemoteCommandStreamError RemoteCommandFailure = "StreamError"
+	// RemoteCommandExitError means the command ran and exited with a non-zero status
+	RemoteCommandExitError RemoteCommandFailure = "ExitError"
+	// RemoteCommandTimeout means the command did not finish in time, it may still be running
+	RemoteCommandTimeout RemoteCommandFailure = "Timeout"
+)
+
+// RemoteCommandError is returned by the PodExecutors when the command could not be run or failed
+type RemoteCommandError struct {
+	Reason     RemoteCommandFailure
+	ExitStatus int
+	// Stderr is the end of the error output of the command, it is left out of the message
+	// since the SQL errors of H2 quote the statements, passwords included
+	Stderr string
+	Err    error
+}
+
+func (e *RemoteCommandError) Error() string {
+	switch e.Reason {
+	case RemoteCommandExitError:
+		return fmt.Sprintf("command exited with status %d", e.ExitStatus)
+	case RemoteCommandTimeout:
+		return fmt.Sprintf("command timed out: %v", e.Err)
+	case RemoteCommandStreamError:
+		return fmt.Sprintf("command interrupted: %v", e.Err)
+	default:
+		return fmt.Sprintf("command could not be run: %v", e.Err)
+	}
+}
+
+func (e *RemoteCommandError) Unwrap() error {
+	return e.Err
+}
+
+// maxStderrLength limits the error output kept in the errors, and hence in the conditions and Events
+const maxStderrLength = 256
+
+// classifyRemoteCommandError wraps an error of the exec stream along with the end of the error output,
+// established tells whether the stream was established before the error, i.e. whether the command may have run
+func classifyRemoteCommandError(err error, stderr string, established bool) *RemoteCommandError {
+	if exitErr, ok := err.(utilexec.ExitError); ok {
+		stderr = strings.TrimSpace(stderr)
+		if len(stderr) > maxStderrLength {
+			stderr = "..." + stderr[len(stderr)-maxStderrLength:]
+		}
+		return &RemoteCommandError{Reason: RemoteCommandExitError, ExitStatus: exitErr.ExitStatus(), Stderr: stderr, Err: err}
+	}
+	if established {
+		return &RemoteCommandError{Reason: RemoteCommandStreamError, Err: err}
+	}
+	return &RemoteCommandError{Reason: RemoteCommandConnectionError, Err: err}
+}
+
+// remoteCommandFailure returns the classification of an error of a remote command
+// NOTE: Errors that don't tell how far the command went are not safe to retry.
+func remoteCommandFailure(err error) RemoteCommandFailure {
+	var rcErr *RemoteCommandError
+	if errors.As(err, &rcErr) {
+		return rcErr.Reason
+	}
+	return RemoteCommandStreamError
+}
+
+// NOTE: Remote commands need the pods/exec permission, which is granted by deploy/role_exec.yaml.
+// They are only run for backups, clustering, H2Users, data migrations when the image changes
+// and the final backup of the BackupThenDelete deletion policy.
+
+// AuditedExec runs the command in the pod through the executor, and records the operation,
+// the pod, the command, its exit status and its duration in a log line and in an Event on obj.
+// Every attempt is bounded by remoteCommandTimeout. Commands whose exec stream could not be established
+// are retried with a backoff, the ones that may have started are never repeated.
+// Failures are also counted in the remote command failures metric.
+// The command is recorded as redacted, so it must not contain any secret.
+func AuditedExec(ctx context.Context, executor PodExecutor, recorder record.EventRecorder, obj runtime.Object, pod *corev1.Pod, operation, command, redacted string) (string, string, error) {
+	return AuditedExecWithStdin(ctx, executor, recorder, obj, pod, operation, command, redacted, "")
+}
+
+// AuditedExecWithStdin is AuditedExec feeding stdin to the command when not empty. Unlike the command line,
+// which ends up in the exec request, the audit records and the process list of the pod, stdin is never
+// recorded, so secrets are passed this way.
+func AuditedExecWithStdin(ctx context.Context, executor PodExecutor, recorder record.EventRecorder, obj runtime.Object, pod *corev1.Pod, operation, command, redacted, stdin string) (string, string, error) {
+	start := time.Now()
+	var stdout, stderr string
+	var err error
+	wait.ExponentialBackoff(remoteCommandBackoff, func() (bool, error) {
+		attemptCtx, cancel := context.WithTimeout(ctx, remoteCommandTimeout)
+		defer cancel()
+		// Every attempt reads stdin from the start
+		var input io.Reader
+		if stdin != "" {
+			input = strings.NewReader(stdin)
+		}
+		stdout, stderr, err = executor.Exec(attemptCtx, pod, command, input)
+		if err != nil && remoteCommandFailure(err) == RemoteCommandConnectionError && ctx.Err() == nil {
+			log.Info("Retrying the remote command.", "Pod.Namespace", pod.Namespace, "Pod.Name", pod.Name, "Operation", operation, "Error", err.Error())
+			return false, nil
+		}
+		return true, nil
+	})
+	duration := time.Since(start).Round(time.Millisecond)
+	status := exitStatus(err)
+
+	auditLogger := log.WithValues("Pod.Namespace", pod.Namespace, "Pod.Name", pod.Name, "Operation", operation,
+		"Command", redacted, "ExitStatus", status, "Duration", duration.String())
+	if err != nil {
+		failure := remoteCommandFailure(err)
+		if accessor, aerr := meta.Accessor(obj); aerr == nil {
+			remoteCommandFailures.WithLabelValues(accessor.GetNamespace(), accessor.GetName(), operation).Inc()
+		}
+		auditLogger.Error(err, "Remote command failed.", "Failure", failure)
+		recorder.Eventf(obj, corev1.EventTypeWarning, eventReasonRemoteCommandFailed,
+			"Remote command %s failed (%s) in pod %s with exit status %d after %s: %s", operation, failure, pod.Name, status, duration, redacted)
+	} else {
+		auditLogger.Info("Remote command succeeded.")
+		recorder.Eventf(obj, corev1.EventTypeNormal, eventReasonRemoteCommand,
+			"Remote command %s succeeded in pod %s after %s: %s", operation, pod.Name, duration, redacted)
+	}
+	return stdout, stderr, err
+}
+
+// exitStatus returns the exit status of a remote command, or -1 if it could not be run
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var rcErr *RemoteCommandError
+	if errors.As(err, &rcErr) && rcErr.Reason == RemoteCommandExitError {
+		return rcErr.ExitStatus
+	}
+	return -1
+}
+
+// redactURL returns the URL with its password and query hidden, the query may hold a signature
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "xxxxx"
+	}
+	return u.String()
+}
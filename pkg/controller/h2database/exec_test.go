@@ -0,0 +1,129 @@
+package h2database
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/controller/h2database/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	remotecommandconsts "k8s.io/apimachinery/pkg/util/remotecommand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+func TestClassifyRemoteCommandError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		established bool
+		want        RemoteCommandFailure
+	}{
+		{"exit status", utilexec.CodeExitError{Err: errors.New("exit 1"), Code: 1}, true, RemoteCommandExitError},
+		{"handshake failure", errors.New("unable to upgrade connection"), false, RemoteCommandConnectionError},
+		{"stream lost", errors.New("connection reset by peer"), true, RemoteCommandStreamError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyRemoteCommandError(tt.err, "", tt.established).Reason; got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+	if got := remoteCommandFailure(errors.New("unknown")); got != RemoteCommandStreamError {
+		t.Errorf("Expected errors of unknown origin not to be retried, got %s", got)
+	}
+}
+
+func TestAuditedExecOnlyRetriesCommandsNotStarted(t *testing.T) {
+	defer func(b wait.Backoff) { remoteCommandBackoff = b }(remoteCommandBackoff)
+	remoteCommandBackoff = wait.Backoff{Duration: time.Millisecond, Steps: 3}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "example-0", Namespace: "default"}}
+
+	tests := []struct {
+		reason   RemoteCommandFailure
+		attempts int
+	}{
+		{RemoteCommandConnectionError, 3},
+		{RemoteCommandStreamError, 1},
+		{RemoteCommandExitError, 1},
+		{RemoteCommandTimeout, 1},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.reason), func(t *testing.T) {
+			executor := &fake.PodExecutor{
+				Handler: func(pod *corev1.Pod, command, stdin string) (string, string, error) {
+					return "", "", &RemoteCommandError{Reason: tt.reason, Err: errors.New("failed")}
+				},
+			}
+			_, _, err := AuditedExecWithStdin(context.TODO(), executor, record.NewFakeRecorder(10), pod, pod, "test", "cat", "cat", "input")
+			if remoteCommandFailure(err) != tt.reason {
+				t.Errorf("Expected a %s, got %v", tt.reason, err)
+			}
+			commands := executor.Commands()
+			if len(commands) != tt.attempts {
+				t.Errorf("Expected %d attempts, got %d", tt.attempts, len(commands))
+			}
+			// Every attempt is fed the whole input
+			for _, command := range commands {
+				if command.Stdin != "input" {
+					t.Errorf("Expected the input on stdin, got %q", command.Stdin)
+				}
+			}
+		})
+	}
+}
+
+func TestPodExecutorTellsStreamFailuresApart(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "example-0", Namespace: "default"}}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    RemoteCommandFailure
+	}{
+		{
+			name: "handshake refused",
+			handler: func(w http.ResponseWriter, req *http.Request) {
+				http.Error(w, "pods/exec is forbidden", http.StatusForbidden)
+			},
+			want: RemoteCommandConnectionError,
+		},
+		{
+			name: "stream dropped",
+			handler: func(w http.ResponseWriter, req *http.Request) {
+				if _, err := httpstream.Handshake(req, w, []string{remotecommandconsts.StreamProtocolV4Name}); err != nil {
+					return
+				}
+				conn := spdy.NewResponseUpgrader().UpgradeResponse(w, req, func(httpstream.Stream, <-chan struct{}) error { return nil })
+				if conn != nil {
+					conn.Close()
+				}
+			},
+			want: RemoteCommandStreamError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			executor, err := NewPodExecutor(&rest.Config{Host: server.URL})
+			if err != nil {
+				t.Fatalf("Failed to create the executor: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+			defer cancel()
+			_, _, err = executor.Exec(ctx, pod, "true", nil)
+			if got := remoteCommandFailure(err); got != tt.want {
+				t.Errorf("Expected a %s, got %s: %v", tt.want, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package h2database
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// PodExecutor runs shell commands in the H2 container of pods
+type PodExecutor interface {
+	// Exec runs the command with /bin/sh, feeding it stdin if not nil, until it exits or ctx is done.
+	// Failures are returned as a *RemoteCommandError.
+	Exec(ctx context.Context, pod *corev1.Pod, command string, stdin io.Reader) (stdout, stderr string, err error)
+}
+
+// remotePodExecutor runs the commands through the exec subresource of the pods
+type remotePodExecutor struct {
+	config *rest.Config
+	client kubernetes.Interface
+}
+
+// NewPodExecutor returns a PodExecutor talking to the API server of the given config, i.e. the one of the manager
+func NewPodExecutor(config *rest.Config) (PodExecutor, error) {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &remotePodExecutor{config: config, client: client}, nil
+}
+
+// Exec implements PodExecutor
+// NOTE: The exec stream of this client-go version can't be cancelled, when ctx is done it is left
+// to finish in the background.
+func (e *remotePodExecutor) Exec(ctx context.Context, pod *corev1.Pod, command string, stdin io.Reader) (string, string, error) {
+	request := e.client.CoreV1().RESTClient().
+		Post().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			// The container has to be named once the pod has sidecars
+			Container: h2ContainerName,
+			Command:   []string{"/bin/sh", "-c", command},
+			Stdin:     stdin != nil,
+			Stdout:    true,
+			Stderr:    true,
+			// Without a TTY the output and the errors are kept apart
+			TTY: false,
+		}, scheme.ParameterCodec)
+	transport, upgrader, err := spdy.RoundTripperFor(e.config)
+	if err != nil {
+		return "", "", &RemoteCommandError{Reason: RemoteCommandConnectionError, Err: err}
+	}
+	stream := &streamUpgrader{Upgrader: upgrader}
+	exec, err := remotecommand.NewSPDYExecutorForTransports(transport, stream, "POST", request.URL())
+	if err != nil {
+		return "", "", &RemoteCommandError{Reason: RemoteCommandConnectionError, Err: err}
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	done := make(chan error, 1)
+	go func() {
+		done <- exec.Stream(remotecommand.StreamOptions{
+			Stdin:  stdin,
+			Stdout: stdout,
+			Stderr: stderr,
+		})
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", "", &RemoteCommandError{Reason: RemoteCommandTimeout, Err: ctx.Err()}
+		}
+		return "", "", classifyRemoteCommandError(ctx.Err(), "", stream.isEstablished())
+	}
+	if err != nil {
+		return stdout.String(), stderr.String(), classifyRemoteCommandError(err, stderr.String(), stream.isEstablished())
+	}
+	return stdout.String(), stderr.String(), nil
+}
+
+// streamUpgrader records whether the exec stream was established: the failures of the request and of the
+// upgrade happen before the command is started, the ones after it may interrupt the command
+type streamUpgrader struct {
+	spdy.Upgrader
+	established int32
+}
+
+// NewConnection implements spdy.Upgrader
+func (u *streamUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.Upgrader.NewConnection(resp)
+	if err == nil {
+		atomic.StoreInt32(&u.established, 1)
+	}
+	return conn, err
+}
+
+// isEstablished returns true once the exec stream has been established
+func (u *streamUpgrader) isEstablished() bool {
+	return atomic.LoadInt32(&u.established) == 1
+}
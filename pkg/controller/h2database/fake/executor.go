@@ -0,0 +1,62 @@
+// Package fake provides a PodExecutor for the tests of the controllers, which records the commands
+// instead of running them in the pods.
+package fake
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Command is a command run by a PodExecutor
+type Command struct {
+	Pod     types.NamespacedName
+	Command string
+	Stdin   string
+}
+
+// PodExecutor implements h2database.PodExecutor, it records the commands instead of running them
+type PodExecutor struct {
+	// Handler returns the result of a command, without it the commands succeed with no output
+	Handler func(pod *corev1.Pod, command, stdin string) (stdout, stderr string, err error)
+
+	mu       sync.Mutex
+	commands []Command
+}
+
+// Exec implements h2database.PodExecutor
+func (e *PodExecutor) Exec(ctx context.Context, pod *corev1.Pod, command string, stdin io.Reader) (string, string, error) {
+	var input string
+	if stdin != nil {
+		b, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return "", "", err
+		}
+		input = string(b)
+	}
+
+	e.mu.Lock()
+	e.commands = append(e.commands, Command{
+		Pod:     types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name},
+		Command: command,
+		Stdin:   input,
+	})
+	handler := e.Handler
+	e.mu.Unlock()
+
+	if handler == nil {
+		return "", "", nil
+	}
+	return handler(pod, command, input)
+}
+
+// Commands returns the commands run so far, in order
+func (e *PodExecutor) Commands() []Command {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Command(nil), e.commands...)
+}
@@ -2,14 +2,28 @@ package h2database
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"reflect"
-	h2v1alpha1 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha1"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -18,37 +32,49 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
-	"k8s.io/client-go/tools/clientcmd"
-	"bytes"
-	"fmt"
-	corev1client "k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/remotecommand"
-	"k8s.io/client-go/kubernetes/scheme"
-	"bufio"
-	"io"
-	"k8s.io/client-go/rest"
-	"github.com/google/uuid"
-	"k8s.io/apimachinery/pkg/api/resource"
 )
 
-var (
-	kubeClient      *corev1client.Clientset
-	inClusterConfig *rest.Config
+var log = logf.Log.WithName("controller_h2database")
+
+// Ports and paths used by the H2 containers
+const (
+	h2TCPPort int32 = 1521
+	h2PGPort  int32 = 5435
+	h2WebPort int32 = 81
+	h2DataDir       = "/opt/h2-data"
 )
 
-var log = logf.Log.WithName("controller_h2database")
+// h2ContainerName is the name of the container running the H2 servers, where the remote commands are run
+const h2ContainerName = "h2database"
+
+// podTemplateHashAnnotation holds the hash of the pod template rendered from the H2 CR spec
+const podTemplateHashAnnotation = "h2.example.com/pod-template-hash"
+
+// credentialsRequeueDelay is how long to wait for a credentials Secret supplied by the user
+const credentialsRequeueDelay = 30 * time.Second
+
+// remoteCommandRetryDelay is how long to wait before running again a backup or clustering command that failed
+const remoteCommandRetryDelay = time.Minute
 
 // INFO: This is the logic of the controller, we need to provide it.
 
 // Add creates a new H2Database Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
-	return add(mgr, newReconciler(mgr))
+	r, err := newReconciler(mgr)
+	if err != nil {
+		return err
+	}
+	return add(mgr, r)
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileH2Database{client: mgr.GetClient(), scheme: mgr.GetScheme()}
+func newReconciler(mgr manager.Manager) (reconcile.Reconciler, error) {
+	executor, err := NewPodExecutor(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+	return &ReconcileH2Database{client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: mgr.GetEventRecorderFor("h2database-controller"), executor: executor}, nil
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
@@ -60,26 +86,67 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	}
 
 	// Watch for changes to primary resource H2Database
-	err = c.Watch(&source.Kind{Type: &h2v1alpha1.H2Database{}}, &handler.EnqueueRequestForObject{})
+	err = c.Watch(&source.Kind{Type: &h2v1alpha2.H2Database{}}, &handler.EnqueueRequestForObject{})
 	if err != nil {
 		return err
 	}
 
-	err = c.Watch(&source.Kind{Type: &appsv1.Deployment{}}, &handler.EnqueueRequestForOwner{
+	err = c.Watch(&source.Kind{Type: &appsv1.StatefulSet{}}, &handler.EnqueueRequestForOwner{
 		IsController: true,
-		OwnerType:    &h2v1alpha1.H2Database{},
+		OwnerType:    &h2v1alpha2.H2Database{},
 	})
+	if err != nil {
+		return err
+	}
 
 	err = c.Watch(&source.Kind{Type: &corev1.Service{}}, &handler.EnqueueRequestForOwner{
 		IsController: true,
-		OwnerType:    &h2v1alpha1.H2Database{},
+		OwnerType:    &h2v1alpha2.H2Database{},
 	})
 
 	if err != nil {
 		return err
 	}
-	
 
+	err = c.Watch(&source.Kind{Type: &corev1.PersistentVolumeClaim{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &h2v1alpha2.H2Database{},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &h2v1alpha2.H2Database{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to the Secrets supplied by the user, e.g. certificates renewed by cert-manager
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: databasesReferringToSecret(mgr.GetClient()),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &h2v1alpha2.H2Database{},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &networkingv1.NetworkPolicy{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &h2v1alpha2.H2Database{},
+	})
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -90,8 +157,10 @@ var _ reconcile.Reconciler = &ReconcileH2Database{}
 type ReconcileH2Database struct {
 	// This client, initialized using mgr.Client() above, is a split client
 	// that reads objects from the cache and writes to the apiserver
-	client client.Client
-	scheme *runtime.Scheme
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	executor PodExecutor
 }
 
 // Reconcile reads that state of the cluster for a H2Database object and makes changes based on the state read
@@ -101,23 +170,35 @@ type ReconcileH2Database struct {
 // Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
 // ***************************************************************************
 // Currently this Reconcile loop does the following thigs:
-// Create a H2 Deployment if it doesn't exist
+// Skip everything but reporting the Paused condition while the H2 CR has the paused annotation
+// Apply the deletion policy of a H2 CR being deleted, through the finalizer added to every H2 CR
+// Fill in the defaults of the H2 CR spec (in case the defaulting webhook is not deployed)
+// Generate the admin credentials Secret if it doesn't exist and the user didn't supply their own
+// Issue the TLS certificate, build the Java keystores and publish the CA bundle when TLS is enabled
+// Create, update or delete the console Secret, Service and Ingress
+// Create a H2 StatefulSet if it doesn't exist, claiming a volume for the data directory of every instance
+// Ensure that the StatefulSet size and pod template are the same as specified by the H2 CR spec
+// Own the data volume claims created by the StatefulSet, so that the deletion policy applies to them
+// Publish the connection details of the database in the binding Secret (and ConfigMap)
+// Create, update or delete the NetworkPolicy restricting the clients of the H2 servers
 // Update the H2 CR status with the names of the H2 pods
-// Ensure that the Deployment size is the same as specified by the H2 CR spec
+// Migrate the data to a new image with the Migrate upgrade strategy, one step at a time
+// Run the one-shot backup and clustering operations, recording their progress in the H2 CR status
+// Maintain the phase and the conditions in the H2 CR status
 func (r *ReconcileH2Database) Reconcile(request reconcile.Request) (reconcile.Result, error) {
 	reqLogger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
-	
 	reqLogger.Info("Reconciling H2Database")
 
 	// Fetch the H2Database instance
-	instance := &h2v1alpha1.H2Database{}
+	instance := &h2v1alpha2.H2Database{}
 	err := r.client.Get(context.TODO(), request.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
-			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
+			// Owned objects are automatically garbage collected, once the deletion policy has been applied.
 			// Return and don't requeue
 			reqLogger.Info("H2Database resource not found. Ignoring since object must be deleted.")
+			forgetH2Database(request.Namespace, request.Name)
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -125,40 +206,161 @@ func (r *ReconcileH2Database) Reconcile(request reconcile.Request) (reconcile.Re
 		return reconcile.Result{}, err
 	}
 
+	// Keep the hands off a paused H2 CR, even when it is being deleted
+	if IsPaused(instance) {
+		return r.reportPaused(instance)
+	}
+
+	// Apply the deletion policy before letting the H2 CR go, and make sure it is applied
+	// NOTE: The finalizer is added before the defaults, so as not to store them along with it.
+	if instance.DeletionTimestamp != nil {
+		instance.Default()
+		return r.finalizeH2Database(instance)
+	}
+	if !containsString(instance.Finalizers, deletionFinalizer) {
+		controllerutil.AddFinalizer(instance, deletionFinalizer)
+		if err := r.client.Update(context.TODO(), instance); err != nil {
+			reqLogger.Error(err, "Failed to add the H2Database finalizer.")
+			return reconcile.Result{}, err
+		}
+	}
+
+	// Objects admitted without the mutating webhook may have empty fields, so apply
+	// the same defaults in memory; the stored spec is left untouched.
+	instance.Default()
+	// NOTE: The status is only written when it differs from the one read at the beginning.
+	originalStatus := instance.Status.DeepCopy()
+	timer := newStepTimer()
+	r.setResumedConditions(instance)
+
+	// Check if the credentials Secret already exists, if not generate a new one
+	// NOTE: A Secret supplied by the user is never created nor modified by the operator.
+	credentials := &corev1.Secret{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: credentialsSecretName(instance), Namespace: instance.Namespace}, credentials)
+	if err != nil && errors.IsNotFound(err) {
+		if instance.Spec.Credentials.SecretName != "" {
+			reqLogger.Info("Waiting for the credentials Secret to be created.", "Secret.Namespace", instance.Namespace, "Secret.Name", instance.Spec.Credentials.SecretName)
+			r.recorder.Eventf(instance, corev1.EventTypeWarning, eventReasonSecretMissing, "Waiting for the credentials Secret %s", instance.Spec.Credentials.SecretName)
+			return reconcile.Result{RequeueAfter: credentialsRequeueDelay}, nil
+		}
+		sec, err := r.credentialsSecretForH2Database(instance)
+		if err != nil {
+			reqLogger.Error(err, "Failed to generate the admin password.")
+			return reconcile.Result{}, err
+		}
+		reqLogger.Info("Creating a new credentials Secret.", "Secret.Namespace", sec.Namespace, "Secret.Name", sec.Name)
+		err = r.client.Create(context.TODO(), sec)
+		if err != nil {
+			reqLogger.Error(err, "Failed to create new credentials Secret.", "Secret.Namespace", sec.Namespace, "Secret.Name", sec.Name)
+			return reconcile.Result{}, err
+		}
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, eventReasonCreated, "Created credentials Secret %s", sec.Name)
+	} else if err != nil {
+		reqLogger.Error(err, "Failed to get credentials Secret.")
+		return reconcile.Result{}, err
+	} else if err := validateCredentialsSecret(credentials); err != nil {
+		reqLogger.Error(err, "Invalid credentials Secret.")
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, eventReasonInvalidSecret, "Invalid credentials Secret %s: %v", credentials.Name, err)
+		return reconcile.Result{RequeueAfter: credentialsRequeueDelay}, nil
+	} else if instance.Spec.Credentials.SecretName == "" {
+		if err := r.adoptRetained(instance, credentials); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	instance.Status.CredentialsSecret = credentialsSecretName(instance)
+	timer.done("credentials")
+
+	// Provision the serving certificate and convert it to the Java keystores read by H2
+	if instance.Spec.TLS.Enabled {
+		ready, err := r.reconcileTLS(instance)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if !ready {
+			return reconcile.Result{RequeueAfter: credentialsRequeueDelay}, nil
+		}
+	} else {
+		instance.Status.CABundle = ""
+		instance.Status.CertificateNotAfter = nil
+	}
+	timer.done("tls")
+
+	// Provision the console admin password, the console Service and Ingress
+	ready, err := r.reconcileConsole(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if !ready {
+		return reconcile.Result{RequeueAfter: credentialsRequeueDelay}, nil
+	}
+	timer.done("console")
 
-	// Check if the Deployment already exists, if not create a new one
-	deployment := &appsv1.Deployment{}
-	err = r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}, deployment)
+	// Check if the StatefulSet already exists, if not create a new one
+	statefulSet := &appsv1.StatefulSet{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}, statefulSet)
 	if err != nil && errors.IsNotFound(err) {
-		// Define a new Deployment
-		dep := r.deploymentForH2Database(instance)
-		reqLogger.Info("Creating a new Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
-		err = r.client.Create(context.TODO(), dep)
+		// The Deployment of an earlier version of the operator would run next to the StatefulSet
+		if err := r.deleteOwned(instance, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: instance.Name, Namespace: instance.Namespace}}); err != nil {
+			return reconcile.Result{}, err
+		}
+		// Define a new StatefulSet
+		recordDataImage(instance, nil)
+		sts := r.statefulSetForH2Database(instance)
+		reqLogger.Info("Creating a new StatefulSet.", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
+		err = r.client.Create(context.TODO(), sts)
 		if err != nil {
-			reqLogger.Error(err, "Failed to create new Deployment.", "Deployment.Namespace", dep.Namespace, "Deployment.Name", dep.Name)
+			reqLogger.Error(err, "Failed to create new StatefulSet.", "StatefulSet.Namespace", sts.Namespace, "StatefulSet.Name", sts.Name)
 			return reconcile.Result{}, err
 		}
-		// Deployment created successfully - return and requeue
-		// NOTE: that the requeue is made with the purpose to provide the deployment object for the next step to ensure the deployment size is the same as the spec.
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, eventReasonCreated, "Created StatefulSet %s", sts.Name)
+		// StatefulSet created successfully - return and requeue
+		// NOTE: that the requeue is made with the purpose to provide the StatefulSet object for the next step to ensure the StatefulSet size is the same as the spec.
 		return reconcile.Result{Requeue: true}, nil
 	} else if err != nil {
-		reqLogger.Error(err, "Failed to get Deployment.")
+		reqLogger.Error(err, "Failed to get StatefulSet.")
 		return reconcile.Result{}, err
 	}
+	// The image the data is written with is run until the data is migrated
+	recordDataImage(instance, statefulSet)
+
+	// Ensure the StatefulSet size is the same as the spec
+	size := *instance.Spec.Size
+	if *statefulSet.Spec.Replicas != size {
+		previous := *statefulSet.Spec.Replicas
+		statefulSet.Spec.Replicas = &size
+		err = r.client.Update(context.TODO(), statefulSet)
+		if err != nil {
+			reqLogger.Error(err, "Failed to update StatefulSet.", "StatefulSet.Namespace", statefulSet.Namespace, "StatefulSet.Name", statefulSet.Name)
+			return reconcile.Result{}, err
+		}
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, eventReasonScaled, "Scaled StatefulSet %s from %d to %d replicas", statefulSet.Name, previous, size)
+	}
 
-	// Ensure the deployment size is the same as the spec
-	size := instance.Spec.Size
-	if *deployment.Spec.Replicas != size {
-		deployment.Spec.Replicas = &size
-		err = r.client.Update(context.TODO(), deployment)
+	// Ensure the StatefulSet pod template is the one rendered from the spec
+	// NOTE: The templates are compared by hash, since the API server fills in defaults. The claim templates
+	// of a StatefulSet cannot be changed.
+	desired := r.statefulSetForH2Database(instance)
+	if statefulSet.Spec.Template.Annotations[podTemplateHashAnnotation] != desired.Spec.Template.Annotations[podTemplateHashAnnotation] {
+		reqLogger.Info("Updating the StatefulSet pod template.", "StatefulSet.Namespace", statefulSet.Namespace, "StatefulSet.Name", statefulSet.Name)
+		statefulSet.Spec.Template = desired.Spec.Template
+		err = r.client.Update(context.TODO(), statefulSet)
 		if err != nil {
-			reqLogger.Error(err, "Failed to update Deployment.", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+			reqLogger.Error(err, "Failed to update StatefulSet.", "StatefulSet.Namespace", statefulSet.Namespace, "StatefulSet.Name", statefulSet.Name)
 			return reconcile.Result{}, err
 		}
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, eventReasonUpdated, "Updated the pod template of StatefulSet %s", statefulSet.Name)
 	}
+	timer.done("statefulset")
+
+	// Own the data volume claims the StatefulSet creates for the instances
+	claims, err := r.reconcileDataClaims(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	timer.done("storage")
 
 	// Check if the Service already exists, if not create a new one
-	// NOTE: The Service is used to expose the Deployment.
+	// NOTE: The Service is used to expose the StatefulSet.
 	service := &corev1.Service{}
 	err = r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}, service)
 	if err != nil && errors.IsNotFound(err) {
@@ -170,10 +372,39 @@ func (r *ReconcileH2Database) Reconcile(request reconcile.Request) (reconcile.Re
 			reqLogger.Error(err, "Failed to create new Service.", "Service.Namespace", ser.Namespace, "Service.Name", ser.Name)
 			return reconcile.Result{}, err
 		}
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, eventReasonCreated, "Created Service %s", ser.Name)
 	} else if err != nil {
 		reqLogger.Error(err, "Failed to get Service.")
 		return reconcile.Result{}, err
+	} else if applyServiceSpec(service, instance) {
+		// Ensure the Service type, ports and annotations are the ones specified by the spec
+		reqLogger.Info("Updating the Service.", "Service.Namespace", service.Namespace, "Service.Name", service.Name)
+		err = r.client.Update(context.TODO(), service)
+		if err != nil {
+			reqLogger.Error(err, "Failed to update Service.", "Service.Namespace", service.Namespace, "Service.Name", service.Name)
+			return reconcile.Result{}, err
+		}
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, eventReasonUpdated, "Updated Service %s", service.Name)
 	}
+	timer.done("service")
+
+	// Publish the connection details for applications, once the credentials Secret is in the cache
+	if len(credentials.Data) > 0 {
+		if err := r.reconcileBinding(instance, credentials); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	// Restrict the clients of the H2 servers to the ones allowed in the spec
+	if err := r.reconcileNetworkPolicy(instance); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Expose the exporter to Prometheus
+	if err := r.reconcileMetrics(instance); err != nil {
+		return reconcile.Result{}, err
+	}
+	timer.done("dependents")
 
 	// Update the H2DB status with the pod names
 	podList := &corev1.PodList{}
@@ -186,349 +417,439 @@ func (r *ReconcileH2Database) Reconcile(request reconcile.Request) (reconcile.Re
 		reqLogger.Error(err, "Failed to list pods.", "H2Database.Namespace", instance.Namespace, "H2Database.Name", instance.Name)
 		return reconcile.Result{}, err
 	}
-	// List the pods for this memcached's deployment
-	podNames := getPodNames(podList.Items)
+	// List the pods of the StatefulSet
+	instance.Status.Nodes = getPodNames(podList.Items)
 
-	// Update status.Nodes if needed
-	if !reflect.DeepEqual(podNames, instance.Status.Nodes) {
-		instance.Status.Nodes = podNames
-		err := r.client.Status().Update(context.TODO(), instance)
-		if err != nil {
-			reqLogger.Error(err, "Failed to update H2Database status.")
-			return reconcile.Result{}, err
-		}
-	}
+	// Report the replica counts and the pod selector for the scale subresource
+	instance.Status.Replicas = statefulSet.Status.Replicas
+	instance.Status.ReadyReplicas = statefulSet.Status.ReadyReplicas
+	instance.Status.Selector = labels.SelectorFromSet(labelsForH2Database(instance.Name)).String()
+	timer.done("pods")
 
-	// Backup the H2 data to a remote location
-	dataBackup := instance.Spec.Backup
-	if dataBackup != "skip" && len(podList.Items) > 0 {
-		// Actually execute the backup inside one of the pods
-		backupLocation := "/tmp/h2_backup.zip"
-		h2DataLocation := "/opt/h2-data"
+	// Migrate the data when the image changes with the Migrate upgrade strategy
+	result, err := r.reconcileUpgrade(instance, statefulSet)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	timer.done("upgrade")
 
-		reqLogger.Info("Executing POST backup to the specified URL...")
-		cmdToExec := fmt.Sprintf("apk add curl zip && zip -r %s %s && curl -X POST --data-binary \"@%s\" %s", backupLocation, h2DataLocation, backupLocation, dataBackup)
-		ExecuteRemoteCommand(&podList.Items[0], cmdToExec)
+	// The failures of the remote commands decide how the request is requeued
+	var resultErr error
 
-		// Skip later checks since this is only a one-time backup feature
-		instance.Spec.Backup = "skip"
+	// Backup the H2 data to a remote location, once for every change of the backup section
+	// NOTE: The progress is tracked in the status, the spec is never modified by the operator.
+	dataBackup := instance.Spec.Backup.URL
+	backupHash := backupRequestHash(instance.Spec.Backup)
+	// NOTE: The data is not backed up while it is migrated.
+	if dataBackup != "" && backupHash != instance.Status.LastBackupHash && len(podList.Items) > 0 && !UpgradeInProgress(instance) {
+		// Actually execute the backup inside one of the pods
+		if execErr := r.runBackup(instance, &podList.Items[0], backupHash); execErr != nil {
+			// The request is not recorded, so that the backup is run again when requeued
+			result, resultErr = requeueAfterRemoteCommand(result, resultErr, execErr)
+		}
+		// Persist the request right away, so that the backup is not repeated if a later step fails
 		err := r.client.Status().Update(context.TODO(), instance)
 		if err != nil {
-			reqLogger.Error(err, "Failed to update H2Database spec.")
+			reqLogger.Error(err, "Failed to update H2Database status.")
 			return reconcile.Result{}, err
 		}
-	} else if dataBackup == "skip" && len(podList.Items) > 0 {
+		originalStatus = instance.Status.DeepCopy()
+	} else if dataBackup == "" && len(podList.Items) > 0 {
 		reqLogger.Info("Skipping backup.")
 	}
+	timer.done("backup")
 
 	// Use H2's CreateCluster script to make a H2 cluster if the there exactly 2 DB instances
-	cluseringMode := instance.Spec.Clustering
-	if cluseringMode == "yes" && len(podList.Items) > 0 && size == 2 {
+	if !instance.Spec.Clustering.Enabled {
+		reqLogger.Info("Skipping Cluster Mode for H2.")
+		instance.Status.ClusterState = h2v1alpha2.ClusterStateDisabled
+	} else if size != 2 || len(podList.Items) != 2 {
+		reqLogger.Info("Cannot run ClusterMode if there is more or less than 2 H2 instances running!")
+		if instance.Status.ClusterState != h2v1alpha2.ClusterStatePending {
+			r.recorder.Eventf(instance, corev1.EventTypeWarning, eventReasonClusterPending,
+				"Clustering needs exactly 2 instances, %d are running", len(podList.Items))
+		}
+		instance.Status.ClusterState = h2v1alpha2.ClusterStatePending
+	} else if instance.Status.ClusterState != h2v1alpha2.ClusterStateFormed {
 		pod1IP := podList.Items[0].Status.PodIP
 		pod2IP := podList.Items[1].Status.PodIP
 
 		reqLogger.Info("Attempting to run in HA mode...")
 		// I'm not sure if the ip addreses are properly handled, since both of the addreses will be
 		// hidden behind a service
-		clusterCmd := fmt.Sprintf("java -cp /opt/h2/bin/h2*.jar org.h2.tools.CreateCluster -urlSource jdbc:h2:tcp://%s:1521/~/test " +
-		"-urlTarget jdbc:h2:tcp://%s:1521/~/test -serverList %s:1521,%s:1521", pod1IP, pod2IP, pod1IP, pod2IP)
+		clusterCmd := fmt.Sprintf("java -cp /opt/h2/bin/h2*.jar org.h2.tools.CreateCluster -urlSource %s "+
+			"-urlTarget %s -user \"$H2_USER\" -password \"$H2_PASSWORD\" -serverList %s:%d,%s:%d",
+			jdbcURL(pod1IP, instance), jdbcURL(pod2IP, instance), pod1IP, h2TCPPort, pod2IP, h2TCPPort)
 
 		// TODO: make sure that we only need to run the CreateCluster script on one machine, and not on both...
-		ExecuteRemoteCommand(&podList.Items[0], clusterCmd)
-
-		// Change the state to 'issued' to indicate that the mode has been switched to ClusterMode
-		instance.Spec.Clustering = "issued"
+		if _, _, execErr := AuditedExec(context.TODO(), r.executor, r.recorder, instance, &podList.Items[0], operationCreateCluster, clusterCmd, clusterCmd); execErr != nil {
+			instance.Status.ClusterState = h2v1alpha2.ClusterStateFailed
+			instance.Status.Conditions.SetCondition(status.Condition{
+				Type:    h2v1alpha2.ConditionClusterReady,
+				Status:  corev1.ConditionFalse,
+				Reason:  remoteCommandReason("Cluster", execErr),
+				Message: fmt.Sprintf("CreateCluster failed: %s", remoteCommandMessage(execErr)),
+			})
+			result, resultErr = requeueAfterRemoteCommand(result, resultErr, execErr)
+		} else {
+			instance.Status.ClusterState = h2v1alpha2.ClusterStateFormed
+			r.recorder.Eventf(instance, corev1.EventTypeNormal, eventReasonClusterFormed, "Formed a cluster of pods %s and %s", podList.Items[0].Name, podList.Items[1].Name)
+		}
+	} else {
+		reqLogger.Info("Cluster Mode for H2 is issued.")
+	}
+	recordClusterState(instance)
+	timer.done("cluster")
+
+	// Summarize the state of the database in the status conditions and phase
+	setStorageCondition(instance, claims)
+	setStatefulSetConditions(instance, statefulSet, podList.Items)
+	setClusterCondition(instance)
+	instance.Status.Phase = phaseForH2Database(instance, statefulSet, podList.Items)
+
+	// Record the generation of the spec that has been handled
+	instance.Status.ObservedGeneration = instance.Generation
+	if !reflect.DeepEqual(*originalStatus, instance.Status) {
 		err := r.client.Status().Update(context.TODO(), instance)
 		if err != nil {
-			reqLogger.Error(err, "Failed to update H2Database spec.")
+			reqLogger.Error(err, "Failed to update H2Database status.")
 			return reconcile.Result{}, err
 		}
-	} else if cluseringMode == "issued" && len(podList.Items) > 0 {
-		reqLogger.Info("Cluster Mode for H2 is issued.")
-	} else if cluseringMode == "no" && len(podList.Items) > 0 {
-		reqLogger.Info("Skipping Cluter Mode for H2.")
-	} else if cluseringMode == "yes" && len(podList.Items) > 0 && size != 2 {
-		reqLogger.Info("Cannot run ClusterMode if there is more or less than 2 H2 instances running!")
-	}
-
-	return reconcile.Result{}, nil
-
-	// ***********************************************************************
-
-	// TODO: Below is leftover from the default operator-sdk controller
-
-	// // Define a new Pod object
-	// pod := newPodForCR(instance)
-
-	// // Set H2Database instance as the owner and controller
-	// if err := controllerutil.SetControllerReference(instance, pod, r.scheme); err != nil {
-	// 	return reconcile.Result{}, err
-	// }
-
-
-	// // Check if this Pod already exists
-	// found := &corev1.Pod{}
-	// err = r.client.Get(context.TODO(), types.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}, found)
-	// if err != nil && errors.IsNotFound(err) {
-	// 	reqLogger.Info("Creating a new Pod", "Pod.Namespace", pod.Namespace, "Pod.Name", pod.Name)
-	// 	err = r.client.Create(context.TODO(), pod)
-	// 	if err != nil {
-	// 		return reconcile.Result{}, err
-	// 	}
-
-	// 	// Pod created successfully - don't requeue
-	// 	return reconcile.Result{}, nil
-	// } else if err != nil {
-	// 	return reconcile.Result{}, err
-	// }
-
-	// // Pod already exists - don't requeue
-	// reqLogger.Info("Skip reconcile: Pod already exists", "Pod.Namespace", found.Namespace, "Pod.Name", found.Name)
-	// return reconcile.Result{}, nil
-}
-
-// ExecuteRemoteCommand executes a remote shell command on the given pod
-// returns the output from stdout and stderr
-
-// TODO: investigate https://github.com/operator-framework/operator-sdk/issues/1021 -
-// sometimes the execution will fail on wait.go:88
-func ExecuteRemoteCommand(pod *corev1.Pod, command string) (string, string, error) {
-	kubeCfg := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		clientcmd.NewDefaultClientConfigLoadingRules(),
-		&clientcmd.ConfigOverrides{},
-	)
-	restCfg, err := kubeCfg.ClientConfig()
-	if err != nil {
-		return "", "", err
-	}
-	coreClient, err := corev1client.NewForConfig(restCfg)
-	if err != nil {
-		return "", "", err
-	}
-
-	buf := &bytes.Buffer{}
-	errBuf := &bytes.Buffer{}
-	request := coreClient.RESTClient().
-		Post().
-		Namespace(pod.Namespace).
-		Resource("pods").
-		Name(pod.Name).
-		SubResource("exec").
-		VersionedParams(&corev1.PodExecOptions{
-			Command: []string{"/bin/sh", "-c", command},
-			Stdin:   false,
-			Stdout:  true,
-			Stderr:  true,
-			TTY:     true,
-		}, scheme.ParameterCodec)
-	exec, err := remotecommand.NewSPDYExecutor(restCfg, "POST", request.URL())
-	if err != nil {
-		return "", "", err
-	}
-	err = exec.Stream(remotecommand.StreamOptions{
-		Stdout: buf,
-		Stderr: errBuf,
-	})
-	if err != nil {
-		return "", "", err
 	}
+	timer.done("status")
 
-	return buf.String(), errBuf.String(), nil
+	return result, resultErr
 }
 
-// Alternative implementaion to the above
-func execCommand(namespace, podName string, stdinReader io.Reader, container *corev1.Container, command ...string) (string, error) {
-
-	execReq := kubeClient.CoreV1().RESTClient().Post()
-	execReq = execReq.Resource("pods").Name(podName).Namespace(namespace).SubResource("exec")
-
-	execReq.VersionedParams(&corev1.PodExecOptions{
-		Container: container.Name,
-		Command:   command,
-		Stdout:    true,
-		Stderr:    true,
-		Stdin:     stdinReader != nil,
-	}, scheme.ParameterCodec)
-
-	exec, err := remotecommand.NewSPDYExecutor(inClusterConfig, "POST", execReq.URL())
-
-	if err != nil {
-		fmt.Println("Creating remote command executor failed: %v", err)
-		return "", err
-	}
-
-	stdOut := bytes.Buffer{}
-	stdErr := bytes.Buffer{}
-	err = exec.Stream(remotecommand.StreamOptions{
-		Stdout: bufio.NewWriter(&stdOut),
-		Stderr: bufio.NewWriter(&stdErr),
-		Stdin:  stdinReader,
-		Tty:    false,
-	})
-
-	fmt.Println("Command stderr: %s", stdErr.String())
-	fmt.Println("Command stdout: %s", stdOut.String())
-
-	if err != nil {
-		fmt.Println("Executing command failed with: %v", err)
-		return "", err
-	}
-
-	fmt.Println("Command succeeded.")
-	if stdErr.Len() > 0 {
-		return "", fmt.Errorf("stderr: %v", stdErr.String())
-	}
-
-	return stdOut.String(), nil
-
-}
-
-// Function to create a PVC. Usage:
-// Client().CoreV1().PersistentVolumeClaims(namespace).Create(createOpts)
-// NOTE: To successfully create this PVC you need a valid hostPath PV with an
-// appropriate size.
-func preparePeristentVolumeClaimFilesystem(h *h2v1alpha1.H2Database) *corev1.PersistentVolumeClaim {
-
-	fs := corev1.PersistentVolumeFilesystem
-	volume, _ := uuid.NewRandom()
-
-    createOpts := &corev1.PersistentVolumeClaim{
-            ObjectMeta: metav1.ObjectMeta{
-                    Name:      volume.String(),
-                    Namespace: h.Namespace,
-                    UID:       types.UID(volume.String()),
-            },
-            Spec: corev1.PersistentVolumeClaimSpec{
-                    AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
-                    Resources: corev1.ResourceRequirements{
-                            Requests: corev1.ResourceList{
-								corev1.ResourceName(corev1.ResourceStorage): resource.MustParse("5Gi"),
-                            },
-                    },
-                    VolumeName: volume.String(),
-                    VolumeMode: &fs,
-            },
-            Status: corev1.PersistentVolumeClaimStatus{
-                    Phase:       corev1.ClaimBound,
-                    AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
-                    Capacity: corev1.ResourceList{
-						corev1.ResourceName(corev1.ResourceStorage): resource.MustParse("5Gi"),
-                    },
-            },
-    }
-	return createOpts
-}
-
-// newPodForCR returns a busybox pod with the same name/namespace as the cr
-func newPodForCRBusyBox(cr *h2v1alpha1.H2Database) *corev1.Pod {
-	labels := map[string]string{
-		"app": cr.Name,
-	}
-	return &corev1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      cr.Name + "-pod",
-			Namespace: cr.Namespace,
-			Labels:    labels,
-		},
-		Spec: corev1.PodSpec{
-			Containers: []corev1.Container{
-				{
-					Name:    "busybox",
-					Image:   "busybox",
-					Command: []string{"sleep", "3600"},
-				},
-			},
-		},
-	}
-}
-
-// deploymentForH2Database returns a H2 Deployment object
-func (r *ReconcileH2Database) deploymentForH2Database(h *h2v1alpha1.H2Database) *appsv1.Deployment {
+// statefulSetForH2Database returns a H2 StatefulSet object
+func (r *ReconcileH2Database) statefulSetForH2Database(h *h2v1alpha2.H2Database) *appsv1.StatefulSet {
 	ls := labelsForH2Database(h.Name)
-	replicas := h.Spec.Size
+	replicas := *h.Spec.Size
+	tmpVolume, tmpMount := tmpVolumeForH2Database()
+	image, _ := dataLayoutForH2Database(h)
+	startupProbe, readinessProbe, livenessProbe := probesForH2Database(h)
 
-	dep := &appsv1.Deployment{
+	sts := &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      h.Name,
 			Namespace: h.Namespace,
 		},
-		Spec: appsv1.DeploymentSpec{
+		Spec: appsv1.StatefulSetSpec{
 			Replicas: &replicas,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: ls,
 			},
+			ServiceName: h.Name,
+			// Pods that never got ready are replaced as well when the pod template changes,
+			// so that a failed migration can be rolled back
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			// Every instance opens the data directory of its own volume
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{dataVolumeClaimTemplate(h)},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: ls,
+					Annotations: map[string]string{
+						seccompPodAnnotation: "runtime/default",
+					},
 				},
 				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{{
-						Image:   "oscarfonts/h2:alpine",
-						Name:    "h2database",
-						Ports: []corev1.ContainerPort{{
-							ContainerPort: 1521,
-							Name:          "h2database",
-						}},
+					SecurityContext: podSecurityContextForH2Database(h),
+					InitContainers: []corev1.Container{{
+						Image:           image,
+						Name:            "init-database",
+						Command:         []string{"/bin/sh", "-c", h2InitDatabaseCommand(h)},
+						Env:             credentialsEnvForH2Database(h),
+						SecurityContext: containerSecurityContextForH2Database(h),
 						VolumeMounts: []corev1.VolumeMount{
-							corev1.VolumeMount{
-								Name:      "h2-testvol",
-								MountPath: "/opt/h2-data-vol", //TODO: Reassign to data path
-							},
+							dataVolumeMountForH2Database(h, false),
+							tmpMount,
 						},
 					}},
-					Volumes: []corev1.Volume{
-						corev1.Volume{
-							Name: "h2-testvol",
-							VolumeSource: corev1.VolumeSource{
-								HostPath: &corev1.HostPathVolumeSource{
-									Path: "/var/k8svols",
-								},
-							},
-						},
-					},
+					Containers: []corev1.Container{{
+						Image:           image,
+						Name:            h2ContainerName,
+						Command:         []string{"/bin/sh", "-c", h2ServerCommand(h)},
+						Env:             append(append(credentialsEnvForH2Database(h), tlsEnvForH2Database(h)...), consoleEnvForH2Database(h)...),
+						Ports:           containerPortsForH2Database(h),
+						StartupProbe:    startupProbe,
+						ReadinessProbe:  readinessProbe,
+						LivenessProbe:   livenessProbe,
+						SecurityContext: containerSecurityContextForH2Database(h),
+						VolumeMounts:    append([]corev1.VolumeMount{dataVolumeMountForH2Database(h, false), tmpMount}, volumeMountsForH2Database(h)...),
+					}},
+					Volumes: []corev1.Volume{tmpVolume},
 				},
 			},
 		},
 	}
-	// Set H2 instance as the owner of the Deployment.
-	controllerutil.SetControllerReference(h, dep, r.scheme)
-	return dep
+	if h.Spec.Metrics.Enabled {
+		podSpec := &sts.Spec.Template.Spec
+		podSpec.Containers = append(podSpec.Containers, exporterContainerForH2Database(h))
+	}
+	if h.Spec.TLS.Enabled {
+		podSpec := &sts.Spec.Template.Spec
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "h2-tls",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: keystoreSecretName(h)},
+			},
+		})
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "h2-tls",
+			MountPath: h2TLSDir,
+			ReadOnly:  true,
+		})
+		if h.Status.CertificateNotAfter != nil {
+			sts.Spec.Template.Annotations[certificateNotAfterAnnotation] = h.Status.CertificateNotAfter.UTC().Format(time.RFC3339)
+		}
+	}
+	sts.Spec.Template.Annotations[podTemplateHashAnnotation] = hashOf(sts.Spec.Template)
+	// Set H2 instance as the owner of the StatefulSet.
+	controllerutil.SetControllerReference(h, sts, r.scheme)
+	return sts
 }
 
 // serviceForH2Database function takes in a H2Database object and returns a Service for that object.
-func (r *ReconcileH2Database) serviceForH2Database(h *h2v1alpha1.H2Database) *corev1.Service {
-	ls := labelsForH2Database(h.Name)
+func (r *ReconcileH2Database) serviceForH2Database(h *h2v1alpha2.H2Database) *corev1.Service {
 	ser := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      h.Name,
 			Namespace: h.Namespace,
 		},
-		Spec: corev1.ServiceSpec{
-			Selector: ls,
-			Ports: []corev1.ServicePort{
-				{
-					Port: 1521,
-					Name: h.Name,
-				},
-			},
-		},
 	}
-	// Set Memcached instance as the owner of the Service.
+	applyServiceSpec(ser, h)
+	// Set H2 instance as the owner of the Service.
 	controllerutil.SetControllerReference(h, ser, r.scheme)
 	return ser
 }
 
+// h2ServerCommand returns the shell command starting the H2 servers enabled in the spec
+// NOTE: The jar is matched with a glob, hence the command is run through a shell.
+func h2ServerCommand(h *h2v1alpha2.H2Database) string {
+	args := []string{
+		// The home directory of the user may not exist nor be writable, H2 keeps its settings there
+		"java", "-Duser.home=" + h2TmpDir, fmt.Sprintf("-Dh2.cacheSizeDefault=%d", h.Spec.CacheSize),
+		"-cp", "/opt/h2/bin/h2*.jar", "org.h2.tools.Server",
+	}
+	if h.HasServerMode(h2v1alpha2.ServerModeTCP) {
+		args = append(args, "-tcp", "-tcpAllowOthers", "-tcpPort", fmt.Sprint(h2TCPPort))
+		if h.Spec.TLS.Enabled {
+			args = append(args, "-tcpSSL")
+		}
+	}
+	if h.HasServerMode(h2v1alpha2.ServerModePG) {
+		args = append(args, "-pg", "-pgAllowOthers", "-pgPort", fmt.Sprint(h2PGPort))
+	} else if h.Spec.Metrics.Enabled {
+		// The exporter queries the database through the PG server, which then only accepts local connections
+		args = append(args, "-pg", "-pgPort", fmt.Sprint(h2PGPort))
+	}
+	if h.HasServerMode(h2v1alpha2.ServerModeWeb) {
+		args = append(args, "-web", "-webPort", fmt.Sprint(h2WebPort))
+		// The console only accepts connections from the pod itself unless allowed explicitly
+		if h.Spec.Console.AllowOthers {
+			args = append(args, "-webAllowOthers")
+		}
+		if h.Spec.Console.Enabled {
+			args = append(args, "-webAdminPassword", "\"$H2_CONSOLE_PASSWORD\"")
+		}
+	}
+	args = append(args, "-baseDir", h2DataDir)
+	return strings.Join(args, " ")
+}
+
+// h2InitDatabaseCommand returns the shell command creating the database along with its admin user,
+// it is a no-op if the database already exists and the credentials match
+func h2InitDatabaseCommand(h *h2v1alpha2.H2Database) string {
+	return fmt.Sprintf("java -cp /opt/h2/bin/h2*.jar org.h2.tools.Shell -url jdbc:h2:%s/%s "+
+		"-user \"$H2_USER\" -password \"$H2_PASSWORD\" -sql \"SELECT 1\"", h2DataDir, h.Spec.Database)
+}
+
+// requeueAfterRemoteCommand adds the failure of a remote command to the result of Reconcile: the commands that
+// could not be run or timed out are retried with the backoff of the queue, the failed or interrupted ones after a delay
+func requeueAfterRemoteCommand(result reconcile.Result, resultErr, execErr error) (reconcile.Result, error) {
+	if resultErr != nil {
+		return result, resultErr
+	}
+	if failure := remoteCommandFailure(execErr); failure != RemoteCommandExitError && failure != RemoteCommandStreamError {
+		return result, execErr
+	}
+	if result.RequeueAfter == 0 || result.RequeueAfter > remoteCommandRetryDelay {
+		result.RequeueAfter = remoteCommandRetryDelay
+	}
+	return result, nil
+}
+
+// runBackup posts a backup of the given H2 CR to its backup URL from the pod, recording the outcome in the
+// Events, the backup metrics and the BackupSucceeded condition. A successful backup is recorded in the status
+// under the given hash, the status is left for the caller to write.
+func (r *ReconcileH2Database) runBackup(h *h2v1alpha2.H2Database, pod *corev1.Pod, hash string) error {
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name)
+	dataBackup := h.Spec.Backup.URL
+
+	reqLogger.Info("Executing POST backup to the specified URL...")
+	r.recorder.Eventf(h, corev1.EventTypeNormal, eventReasonBackupStarted, "Backing up to %s", redactURL(dataBackup))
+	start := time.Now()
+	command := backupCommand(h)
+	stdout, _, execErr := AuditedExecWithStdin(context.TODO(), r.executor, r.recorder, h, pod, operationBackup, command, command, dataBackup+"\n")
+	recordBackup(h, stdout, time.Since(start), execErr)
+	if execErr != nil {
+		message := fmt.Sprintf("Backup to %s failed: %s", redactURL(dataBackup), strings.Replace(remoteCommandMessage(execErr), dataBackup, redactURL(dataBackup), -1))
+		r.recorder.Event(h, corev1.EventTypeWarning, eventReasonBackupFailed, message)
+		h.Status.Conditions.SetCondition(status.Condition{
+			Type:    h2v1alpha2.ConditionBackupSucceeded,
+			Status:  corev1.ConditionFalse,
+			Reason:  remoteCommandReason("Backup", execErr),
+			Message: message,
+		})
+		return execErr
+	}
+	r.recorder.Eventf(h, corev1.EventTypeNormal, eventReasonBackupSucceeded, "Backup posted to %s", redactURL(dataBackup))
+	now := metav1.Now()
+	h.Status.LastBackupHash = hash
+	// NOTE: The status is readable by every user of the H2 CRs, so the URL is recorded without its credentials.
+	h.Status.LastBackupURL = redactURL(dataBackup)
+	h.Status.LastBackupTime = &now
+	h.Status.Conditions.SetCondition(status.Condition{
+		Type:    h2v1alpha2.ConditionBackupSucceeded,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasonBackupPosted,
+		Message: fmt.Sprintf("Backup posted to %s", redactURL(dataBackup)),
+	})
+	return nil
+}
+
+// backupCommand returns the shell command posting a backup of the database of the given H2 CR to the URL
+// read from the first line of its standard input, which may hold credentials or a signature
+// NOTE: The H2 containers run unprivileged, so the backup is made with H2's BACKUP statement,
+// which is consistent while the database is in use, and posted with the wget of the image.
+func backupCommand(h *h2v1alpha2.H2Database) string {
+	backupLocation := h2TmpDir + "/h2_backup.zip"
+	// The size is printed for the backup metrics
+	return fmt.Sprintf("IFS= read -r url && %s && echo \"backup-size: $(wc -c < %s)\" && wget -q -O /dev/null --header 'Content-Type: application/zip' --post-file %s \"$url\"; status=$?; rm -f %s; exit $status",
+		SQLShellCommand(h, "BACKUP TO "+QuoteSQLString(backupLocation)), backupLocation, backupLocation, backupLocation)
+}
+
+// jdbcURL returns the URL of the database of the given H2 CR served by the TCP server at host
+// NOTE: H2 does not verify the host name of the server certificate, so pod IPs can be used with TLS.
+func jdbcURL(host string, h *h2v1alpha2.H2Database) string {
+	protocol := "tcp"
+	if h.Spec.TLS.Enabled {
+		protocol = "ssl"
+	}
+	return fmt.Sprintf("jdbc:h2:%s://%s:%d/%s", protocol, host, h2TCPPort, h.Spec.Database)
+}
+
+// containerPortsForH2Database returns the container ports of the H2 servers enabled in the spec
+func containerPortsForH2Database(h *h2v1alpha2.H2Database) []corev1.ContainerPort {
+	var ports []corev1.ContainerPort
+	if h.HasServerMode(h2v1alpha2.ServerModeTCP) {
+		ports = append(ports, corev1.ContainerPort{ContainerPort: h2TCPPort, Name: "h2database"})
+	}
+	if h.HasServerMode(h2v1alpha2.ServerModePG) {
+		ports = append(ports, corev1.ContainerPort{ContainerPort: h2PGPort, Name: "pg"})
+	}
+	if h.HasServerMode(h2v1alpha2.ServerModeWeb) {
+		ports = append(ports, corev1.ContainerPort{ContainerPort: h2WebPort, Name: "web"})
+	}
+	return ports
+}
+
+// servicePortsForH2Database returns the Service ports of the H2 servers enabled in the spec
+// NOTE: The defaulted fields are set explicitly, so that the Service is not updated every time.
+func servicePortsForH2Database(h *h2v1alpha2.H2Database) []corev1.ServicePort {
+	var ports []corev1.ServicePort
+	port := func(name string, number int32) corev1.ServicePort {
+		return corev1.ServicePort{Name: name, Protocol: corev1.ProtocolTCP, Port: number, TargetPort: intstr.FromInt(int(number))}
+	}
+	if h.HasServerMode(h2v1alpha2.ServerModeTCP) {
+		ports = append(ports, port("tcp", h2TCPPort))
+	}
+	if h.HasServerMode(h2v1alpha2.ServerModePG) {
+		ports = append(ports, port("pg", h2PGPort))
+	}
+	if h.HasServerMode(h2v1alpha2.ServerModeWeb) {
+		ports = append(ports, port("web", h2WebPort))
+	}
+	return ports
+}
+
+// deleteOwned deletes the object named like obj if it exists and is controlled by the given H2 CR
+func (r *ReconcileH2Database) deleteOwned(h *h2v1alpha2.H2Database, obj runtime.Object) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name, "Object.Type", fmt.Sprintf("%T", obj), "Object.Name", accessor.GetName())
+
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: accessor.GetName(), Namespace: accessor.GetNamespace()}, obj)
+	if err != nil {
+		// NOTE: A kind the cluster doesn't serve, like a recent Ingress, can't have any object to delete.
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return nil
+		}
+		reqLogger.Error(err, "Failed to get the object to delete.")
+		return err
+	}
+	if !metav1.IsControlledBy(accessor, h) {
+		return nil
+	}
+	reqLogger.Info("Deleting an object no longer required by the spec.")
+	err = r.client.Delete(context.TODO(), obj)
+	if err != nil && !errors.IsNotFound(err) {
+		reqLogger.Error(err, "Failed to delete the object.")
+		return err
+	}
+	return nil
+}
+
+// databasesReferringToSecret maps a Secret to the H2 CRs in its namespace using it as their credentials,
+// TLS or console Secret
+func databasesReferringToSecret(c client.Client) handler.ToRequestsFunc {
+	return func(a handler.MapObject) []reconcile.Request {
+		databases := &h2v1alpha2.H2DatabaseList{}
+		if err := c.List(context.TODO(), databases, client.InNamespace(a.Meta.GetNamespace())); err != nil {
+			log.Error(err, "Failed to list H2Databases.", "Namespace", a.Meta.GetNamespace())
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, h := range databases.Items {
+			name := a.Meta.GetName()
+			if h.Spec.Credentials.SecretName == name || h.Spec.TLS.SecretName == name || h.Spec.Console.AdminPasswordSecret == name {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: h.Name, Namespace: h.Namespace}})
+			}
+		}
+		return requests
+	}
+}
+
 // labelsForH2Database returns the labels for selecting the resources
 // belonging to the given h2 CR name.
 func labelsForH2Database(name string) map[string]string {
 	return map[string]string{"app": "h2database", "h2database_cr": name}
 }
 
-// getPodNames returns the pod names of the array of pods passed in
+// backupRequestHash returns a short hash identifying the backup section of the spec,
+// a backup is taken whenever it differs from the one recorded in the status
+func backupRequestHash(b h2v1alpha2.H2DatabaseBackup) string {
+	// NOTE: Where the backups are deleted from doesn't call for another backup.
+	b.DeleteURL = ""
+	return hashOf(b)
+}
+
+// hashOf returns a short hash of the JSON representation of v
+func hashOf(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// getPodNames returns the sorted pod names of the array of pods passed in,
+// so that the status does not change with the order of the list
 func getPodNames(pods []corev1.Pod) []string {
 	var podNames []string
 	for _, pod := range pods {
 		podNames = append(podNames, pod.Name)
 	}
+	sort.Strings(podNames)
 	return podNames
-}
\ No newline at end of file
+}
@@ -0,0 +1,624 @@
+package h2database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/controller/h2database/fake"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestReconcileCreatesStatefulSetAndService(t *testing.T) {
+	requireEnvironment(t)
+	h := newTestH2Database(t, newTestNamespace(t), nil)
+	r := newTestReconciler(&fake.PodExecutor{})
+
+	// The first pass creates the StatefulSet and requeues
+	if result := reconcileTestH2Database(t, r, h); !result.Requeue {
+		t.Errorf("Expected a requeue after creating the StatefulSet, got %+v", result)
+	}
+	reconcileTestH2Database(t, r, h)
+
+	sts := &appsv1.StatefulSet{}
+	getTestObject(t, h, "", sts)
+	if *sts.Spec.Replicas != h2v1alpha2.DefaultSize {
+		t.Errorf("Expected %d replicas, got %d", h2v1alpha2.DefaultSize, *sts.Spec.Replicas)
+	}
+	if ref := metav1.GetControllerOf(sts); ref == nil || ref.UID != h.UID {
+		t.Errorf("Expected the StatefulSet to be controlled by the H2Database, got %v", ref)
+	}
+	if c := sts.Spec.Template.Spec.Containers[0]; c.Name != h2ContainerName || c.Image != h2v1alpha2.DefaultImage {
+		t.Errorf("Unexpected H2 container %s with image %s", c.Name, c.Image)
+	}
+	// Every instance gets its own data volume
+	if claims := sts.Spec.VolumeClaimTemplates; len(claims) != 1 || claims[0].Name != dataVolumeName ||
+		!claims[0].Spec.Resources.Requests[corev1.ResourceStorage].Equal(h.Spec.Storage.Size) {
+		t.Errorf("Expected a claim template for the data volume, got %+v", claims)
+	}
+
+	ser := &corev1.Service{}
+	getTestObject(t, h, "", ser)
+	if len(ser.Spec.Ports) != 1 || ser.Spec.Ports[0].Port != h2TCPPort {
+		t.Errorf("Expected the Service to expose the TCP server only, got %+v", ser.Spec.Ports)
+	}
+
+	getTestObject(t, h, credentialsSecretName(h), &corev1.Secret{})
+	getTestObject(t, h, bindingName(h), &corev1.Secret{})
+}
+
+func TestReconcileScalesStatefulSet(t *testing.T) {
+	requireEnvironment(t)
+	h := newTestH2Database(t, newTestNamespace(t), nil)
+	r := newTestReconciler(&fake.PodExecutor{})
+	reconcileTestH2Database(t, r, h)
+	reconcileTestH2Database(t, r, h)
+
+	getTestObject(t, h, "", h)
+	size := int32(3)
+	h.Spec.Size = &size
+	if err := testClient.Update(context.TODO(), h); err != nil {
+		t.Fatalf("Failed to scale the H2Database: %v", err)
+	}
+	reconcileTestH2Database(t, r, h)
+
+	sts := &appsv1.StatefulSet{}
+	getTestObject(t, h, "", sts)
+	if *sts.Spec.Replicas != size {
+		t.Errorf("Expected %d replicas, got %d", size, *sts.Spec.Replicas)
+	}
+}
+
+func TestReconcileUpdatesStatus(t *testing.T) {
+	requireEnvironment(t)
+	h := newTestH2Database(t, newTestNamespace(t), nil)
+	r := newTestReconciler(&fake.PodExecutor{})
+	reconcileTestH2Database(t, r, h)
+	createTestPod(t, h, "example-0", "10.0.0.1")
+	reconcileTestH2Database(t, r, h)
+
+	getTestObject(t, h, "", h)
+	if h.Status.ObservedGeneration != h.Generation {
+		t.Errorf("Expected observed generation %d, got %d", h.Generation, h.Status.ObservedGeneration)
+	}
+	if len(h.Status.Nodes) != 1 || h.Status.Nodes[0] != "example-0" {
+		t.Errorf("Expected the pod in the nodes, got %v", h.Status.Nodes)
+	}
+	if h.Status.CredentialsSecret != credentialsSecretName(h) {
+		t.Errorf("Expected credentials Secret %s, got %s", credentialsSecretName(h), h.Status.CredentialsSecret)
+	}
+	if h.Status.Selector == "" {
+		t.Error("Expected the pod selector in the status")
+	}
+	// Nothing creates the claims nor runs the pods of the StatefulSets in the test environment
+	if h.Status.Phase != h2v1alpha2.PhasePending {
+		t.Errorf("Expected phase %s, got %s", h2v1alpha2.PhasePending, h.Status.Phase)
+	}
+	if !h.Status.Conditions.IsFalseFor(h2v1alpha2.ConditionStorageReady) {
+		t.Errorf("Expected StorageReady to be false, got %+v", h.Status.Conditions)
+	}
+
+	// The claim of the instance is owned once created, and the instance provisioned once it is bound
+	claim := createTestClaim(t, h, 0, true)
+	reconcileTestH2Database(t, r, h)
+	getTestObject(t, h, claim.Name, claim)
+	if ref := metav1.GetControllerOf(claim); ref == nil || ref.UID != h.UID {
+		t.Errorf("Expected the claim to be controlled by the H2Database, got %v", ref)
+	}
+	getTestObject(t, h, "", h)
+	if h.Status.Phase != h2v1alpha2.PhaseProvisioning || !h.Status.Conditions.IsTrueFor(h2v1alpha2.ConditionStorageReady) {
+		t.Errorf("Expected phase %s with StorageReady true, got %s %+v", h2v1alpha2.PhaseProvisioning, h.Status.Phase, h.Status.Conditions)
+	}
+}
+
+func TestReconcileRunsBackupOnce(t *testing.T) {
+	requireEnvironment(t)
+	const url = "https://backup.example.com/h2?signature=secret"
+	h := newTestH2Database(t, newTestNamespace(t), func(h *h2v1alpha2.H2Database) {
+		h.Spec.Backup.URL = url
+	})
+	executor := &fake.PodExecutor{
+		Handler: func(pod *corev1.Pod, command, stdin string) (string, string, error) {
+			return "backup-size: 1234\n", "", nil
+		},
+	}
+	r := newTestReconciler(executor)
+	reconcileTestH2Database(t, r, h)
+	createTestPod(t, h, "example-0", "10.0.0.1")
+	reconcileTestH2Database(t, r, h)
+	reconcileTestH2Database(t, r, h)
+
+	commands := executor.Commands()
+	if len(commands) != 1 {
+		t.Fatalf("Expected a single backup command, got %d", len(commands))
+	}
+	if commands[0].Pod.Name != "example-0" || !strings.Contains(commands[0].Command, "BACKUP TO") || commands[0].Stdin != url+"\n" {
+		t.Errorf("Unexpected backup command in pod %s: %s", commands[0].Pod.Name, commands[0].Command)
+	}
+	// The URL is fed through stdin, never on the command line
+	if strings.Contains(commands[0].Command, "backup.example.com") {
+		t.Errorf("Expected the URL to be kept out of the command, got %s", commands[0].Command)
+	}
+
+	getTestObject(t, h, "", h)
+	if h.Status.LastBackupHash != backupRequestHash(h.Spec.Backup) || h.Status.LastBackupTime == nil {
+		t.Errorf("Expected the backup to be recorded in the status, got %+v", h.Status)
+	}
+	if !h.Status.Conditions.IsTrueFor(h2v1alpha2.ConditionBackupSucceeded) {
+		t.Errorf("Expected BackupSucceeded to be true, got %+v", h.Status.Conditions)
+	}
+	// The signature of the URL is left out of the status
+	c := h.Status.Conditions.GetCondition(h2v1alpha2.ConditionBackupSucceeded)
+	if strings.Contains(h.Status.LastBackupURL, "secret") || strings.Contains(c.Message, "secret") {
+		t.Errorf("Expected the backup URL to be redacted, got %s and %q", h.Status.LastBackupURL, c.Message)
+	}
+}
+
+func TestReconcileRetriesFailedBackup(t *testing.T) {
+	requireEnvironment(t)
+	h := newTestH2Database(t, newTestNamespace(t), func(h *h2v1alpha2.H2Database) {
+		h.Spec.Backup.URL = "https://backup.example.com/h2"
+	})
+	executor := &fake.PodExecutor{
+		Handler: func(pod *corev1.Pod, command, stdin string) (string, string, error) {
+			return "", "wget: server returned error: HTTP/1.1 503", &RemoteCommandError{Reason: RemoteCommandExitError, ExitStatus: 1}
+		},
+	}
+	r := newTestReconciler(executor)
+	reconcileTestH2Database(t, r, h)
+	createTestPod(t, h, "example-0", "10.0.0.1")
+
+	if result := reconcileTestH2Database(t, r, h); result.RequeueAfter != remoteCommandRetryDelay {
+		t.Errorf("Expected a requeue after %s, got %+v", remoteCommandRetryDelay, result)
+	}
+	getTestObject(t, h, "", h)
+	if h.Status.LastBackupHash != "" {
+		t.Errorf("Expected the failed backup not to be recorded, got hash %s", h.Status.LastBackupHash)
+	}
+	c := h.Status.Conditions.GetCondition(h2v1alpha2.ConditionBackupSucceeded)
+	if c == nil || c.Status != corev1.ConditionFalse || c.Reason != "BackupCommandFailed" {
+		t.Errorf("Expected BackupSucceeded to be false because of the command, got %+v", c)
+	}
+
+	// The backup is run again by the next reconciliation
+	reconcileTestH2Database(t, r, h)
+	if n := len(executor.Commands()); n != 2 {
+		t.Errorf("Expected the backup to be retried, got %d commands", n)
+	}
+}
+
+func TestReconcileFormsCluster(t *testing.T) {
+	requireEnvironment(t)
+	h := newTestH2Database(t, newTestNamespace(t), func(h *h2v1alpha2.H2Database) {
+		size := int32(2)
+		h.Spec.Size = &size
+		h.Spec.Clustering.Enabled = true
+	})
+	executor := &fake.PodExecutor{}
+	r := newTestReconciler(executor)
+	reconcileTestH2Database(t, r, h)
+	reconcileTestH2Database(t, r, h)
+
+	getTestObject(t, h, "", h)
+	if h.Status.ClusterState != h2v1alpha2.ClusterStatePending {
+		t.Errorf("Expected cluster state %s without pods, got %s", h2v1alpha2.ClusterStatePending, h.Status.ClusterState)
+	}
+
+	createTestPod(t, h, "example-0", "10.0.0.1")
+	createTestPod(t, h, "example-1", "10.0.0.2")
+	reconcileTestH2Database(t, r, h)
+	reconcileTestH2Database(t, r, h)
+
+	commands := executor.Commands()
+	if len(commands) != 1 || !strings.Contains(commands[0].Command, "CreateCluster") ||
+		!strings.Contains(commands[0].Command, "-serverList 10.0.0.1:1521,10.0.0.2:1521") {
+		t.Errorf("Expected a single CreateCluster command, got %+v", commands)
+	}
+	getTestObject(t, h, "", h)
+	if h.Status.ClusterState != h2v1alpha2.ClusterStateFormed || !h.Status.Conditions.IsTrueFor(h2v1alpha2.ConditionClusterReady) {
+		t.Errorf("Expected the cluster to be formed, got %s %+v", h.Status.ClusterState, h.Status.Conditions)
+	}
+}
+
+func TestReconcileDeletedH2Database(t *testing.T) {
+	requireEnvironment(t)
+	requests := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests <- req.Method + " " + req.URL.Path
+	}))
+	defer server.Close()
+	h := newTestH2Database(t, newTestNamespace(t), func(h *h2v1alpha2.H2Database) {
+		h.Spec.Backup.DeleteURL = server.URL + "/backups/example"
+	})
+	r := newTestReconciler(&fake.PodExecutor{})
+	reconcileTestH2Database(t, r, h)
+	createTestClaim(t, h, 0, true)
+	reconcileTestH2Database(t, r, h)
+
+	getTestObject(t, h, "", h)
+	if !containsString(h.Finalizers, deletionFinalizer) {
+		t.Fatalf("Expected the deletion finalizer, got %v", h.Finalizers)
+	}
+	if err := testClient.Delete(context.TODO(), h); err != nil {
+		t.Fatalf("Failed to delete the H2Database: %v", err)
+	}
+	if result := reconcileTestH2Database(t, r, h); result.Requeue || result.RequeueAfter != 0 {
+		t.Errorf("Expected no requeue for a deleted H2Database, got %+v", result)
+	}
+	select {
+	case request := <-requests:
+		if request != "DELETE /backups/example" {
+			t.Errorf("Expected the backups to be deleted, got %q", request)
+		}
+	default:
+		t.Error("Expected the backups to be deleted")
+	}
+	err := testClient.Get(context.TODO(), types.NamespacedName{Namespace: h.Namespace, Name: h.Name}, &h2v1alpha2.H2Database{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("Expected the H2Database to be gone, got %v", err)
+	}
+
+	// The dependents are left to the garbage collector, which doesn't run in the test environment
+	sts := &appsv1.StatefulSet{}
+	getTestObject(t, h, "", sts)
+	pvc := &corev1.PersistentVolumeClaim{}
+	getTestObject(t, h, dataVolumeClaimName(h, 0), pvc)
+	for _, obj := range []metav1.Object{sts, pvc} {
+		if ref := metav1.GetControllerOf(obj); ref == nil || ref.UID != h.UID {
+			t.Errorf("Expected %T to be controlled by the H2Database, got %v", obj, ref)
+		}
+	}
+}
+
+func TestReconcileRetainsData(t *testing.T) {
+	requireEnvironment(t)
+	ns := newTestNamespace(t)
+	h := newTestH2Database(t, ns, func(h *h2v1alpha2.H2Database) {
+		h.Spec.DeletionPolicy = h2v1alpha2.DeletionPolicyRetain
+	})
+	r := newTestReconciler(&fake.PodExecutor{})
+	reconcileTestH2Database(t, r, h)
+	createTestClaim(t, h, 0, true)
+	reconcileTestH2Database(t, r, h)
+	getTestObject(t, h, "", h)
+	if err := testClient.Delete(context.TODO(), h); err != nil {
+		t.Fatalf("Failed to delete the H2Database: %v", err)
+	}
+	reconcileTestH2Database(t, r, h)
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	getTestObject(t, h, dataVolumeClaimName(h, 0), pvc)
+	sec := &corev1.Secret{}
+	getTestObject(t, h, credentialsSecretName(h), sec)
+	for _, obj := range []metav1.Object{pvc, sec} {
+		if refs := obj.GetOwnerReferences(); len(refs) != 0 {
+			t.Errorf("Expected %T to be released, got %v", obj, refs)
+		}
+	}
+
+	// A H2Database of the same name picks up the data again
+	h = newTestH2Database(t, ns, nil)
+	reconcileTestH2Database(t, r, h)
+	getTestObject(t, h, dataVolumeClaimName(h, 0), pvc)
+	getTestObject(t, h, credentialsSecretName(h), sec)
+	for _, obj := range []metav1.Object{pvc, sec} {
+		if ref := metav1.GetControllerOf(obj); ref == nil || ref.UID != h.UID {
+			t.Errorf("Expected %T to be adopted by the new H2Database, got %v", obj, ref)
+		}
+	}
+}
+
+func TestReconcileBacksUpBeforeDeletion(t *testing.T) {
+	requireEnvironment(t)
+	h := newTestH2Database(t, newTestNamespace(t), func(h *h2v1alpha2.H2Database) {
+		h.Spec.DeletionPolicy = h2v1alpha2.DeletionPolicyBackupThenDelete
+	})
+	executor := &fake.PodExecutor{}
+	r := newTestReconciler(executor)
+	reconcileTestH2Database(t, r, h)
+	createTestPod(t, h, "example-0", "10.0.0.1")
+	getTestObject(t, h, "", h)
+	if err := testClient.Delete(context.TODO(), h); err != nil {
+		t.Fatalf("Failed to delete the H2Database: %v", err)
+	}
+
+	// Nowhere to post the final backup
+	if result := reconcileTestH2Database(t, r, h); result.RequeueAfter != deletionRequeueDelay {
+		t.Errorf("Expected a requeue after %s without a backup URL, got %+v", deletionRequeueDelay, result)
+	}
+	getTestObject(t, h, "", h)
+	h.Spec.Backup.URL = "https://backup.example.com/h2"
+	if err := testClient.Update(context.TODO(), h); err != nil {
+		t.Fatalf("Failed to set the backup URL: %v", err)
+	}
+	reconcileTestH2Database(t, r, h)
+
+	commands := executor.Commands()
+	if len(commands) != 1 || !strings.Contains(commands[0].Command, "BACKUP TO") {
+		t.Errorf("Expected a single final backup, got %+v", commands)
+	}
+	err := testClient.Get(context.TODO(), types.NamespacedName{Namespace: h.Namespace, Name: h.Name}, &h2v1alpha2.H2Database{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("Expected the H2Database to be gone after the final backup, got %v", err)
+	}
+}
+
+func TestReconcilePausedH2Database(t *testing.T) {
+	requireEnvironment(t)
+	h := newTestH2Database(t, newTestNamespace(t), func(h *h2v1alpha2.H2Database) {
+		h.Annotations = map[string]string{pausedAnnotation: "true"}
+	})
+	r := newTestReconciler(&fake.PodExecutor{})
+	reconcileTestH2Database(t, r, h)
+
+	err := testClient.Get(context.TODO(), types.NamespacedName{Namespace: h.Namespace, Name: h.Name}, &appsv1.StatefulSet{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("Expected no StatefulSet for a paused H2Database, got %v", err)
+	}
+	getTestObject(t, h, "", h)
+	if !h.Status.Conditions.IsTrueFor(h2v1alpha2.ConditionPaused) {
+		t.Errorf("Expected Paused to be true, got %+v", h.Status.Conditions)
+	}
+	if len(h.Finalizers) != 0 {
+		t.Errorf("Expected no finalizer for a paused H2Database, got %v", h.Finalizers)
+	}
+
+	delete(h.Annotations, pausedAnnotation)
+	if err := testClient.Update(context.TODO(), h); err != nil {
+		t.Fatalf("Failed to resume the H2Database: %v", err)
+	}
+	reconcileTestH2Database(t, r, h)
+	reconcileTestH2Database(t, r, h)
+	getTestObject(t, h, "", &appsv1.StatefulSet{})
+	getTestObject(t, h, "", h)
+	if c := h.Status.Conditions.GetCondition(h2v1alpha2.ConditionPaused); c != nil {
+		t.Errorf("Expected no Paused condition once resumed, got %+v", c)
+	}
+}
+
+func TestReconcileMaintenanceMode(t *testing.T) {
+	requireEnvironment(t)
+	h := newTestH2Database(t, newTestNamespace(t), func(h *h2v1alpha2.H2Database) {
+		h.Annotations = map[string]string{maintenanceAnnotation: "true"}
+	})
+	r := newTestReconciler(&fake.PodExecutor{})
+	reconcileTestH2Database(t, r, h)
+	reconcileTestH2Database(t, r, h)
+
+	ser := &corev1.Service{}
+	getTestObject(t, h, "", ser)
+	if ser.Spec.Selector[maintenanceSelectorLabel] != "true" {
+		t.Errorf("Expected the Service to select no pod in maintenance, got %v", ser.Spec.Selector)
+	}
+	getTestObject(t, h, "", &appsv1.StatefulSet{})
+	getTestObject(t, h, "", h)
+	if !h.Status.Conditions.IsTrueFor(h2v1alpha2.ConditionMaintenance) {
+		t.Errorf("Expected Maintenance to be true, got %+v", h.Status.Conditions)
+	}
+
+	delete(h.Annotations, maintenanceAnnotation)
+	if err := testClient.Update(context.TODO(), h); err != nil {
+		t.Fatalf("Failed to end the maintenance: %v", err)
+	}
+	reconcileTestH2Database(t, r, h)
+	getTestObject(t, h, "", ser)
+	if _, ok := ser.Spec.Selector[maintenanceSelectorLabel]; ok {
+		t.Errorf("Expected the Service to select the H2 pods again, got %v", ser.Spec.Selector)
+	}
+	getTestObject(t, h, "", h)
+	if c := h.Status.Conditions.GetCondition(h2v1alpha2.ConditionMaintenance); c != nil {
+		t.Errorf("Expected no Maintenance condition after the maintenance, got %+v", c)
+	}
+}
+
+// rowCountExecutor answers the row counting commands of the migrations with a table holding the rows
+// returned by rows for the pod
+func rowCountExecutor(rows func(pod *corev1.Pod) int) *fake.PodExecutor {
+	return &fake.PodExecutor{
+		Handler: func(pod *corev1.Pod, command, stdin string) (string, string, error) {
+			switch {
+			case strings.Contains(command, "h2_upgrade-list-tables.csv"):
+				return "\"TABLE_SCHEMA\",\"TABLE_NAME\"\n\"PUBLIC\",\"ITEMS\"\n", "", nil
+			case strings.Contains(command, "h2_upgrade-export.csv"), strings.Contains(command, "h2_upgrade-count-rows.csv"):
+				return fmt.Sprintf("\"'PUBLIC.ITEMS'\",\"COUNT(*)\"\n\"PUBLIC.ITEMS\",\"%d\"\n", rows(pod)), "", nil
+			}
+			return "", "", nil
+		},
+	}
+}
+
+// startTestUpgrade runs a H2Database with the Migrate strategy on the old image, then requests the new one
+func startTestUpgrade(t *testing.T, r *ReconcileH2Database) *h2v1alpha2.H2Database {
+	t.Helper()
+	h := newTestH2Database(t, newTestNamespace(t), func(h *h2v1alpha2.H2Database) {
+		h.Spec.Image = "oscarfonts/h2:1.4.200"
+		h.Spec.Upgrade.Strategy = h2v1alpha2.UpgradeStrategyMigrate
+	})
+	reconcileTestH2Database(t, r, h)
+	reconcileTestH2Database(t, r, h)
+	createTestPod(t, h, "example-0", "10.0.0.1")
+
+	getTestObject(t, h, "", h)
+	h.Spec.Image = "oscarfonts/h2:2.1.214"
+	if err := testClient.Update(context.TODO(), h); err != nil {
+		t.Fatalf("Failed to change the image: %v", err)
+	}
+	return h
+}
+
+func TestReconcileMigratesData(t *testing.T) {
+	requireEnvironment(t)
+	executor := rowCountExecutor(func(pod *corev1.Pod) int { return 3 })
+	r := newTestReconciler(executor)
+	h := startTestUpgrade(t, r)
+
+	// The clients are cut off and the data exported with the old image
+	reconcileTestH2Database(t, r, h)
+	reconcileTestH2Database(t, r, h)
+	ser := &corev1.Service{}
+	getTestObject(t, h, "", ser)
+	if ser.Spec.Selector[maintenanceSelectorLabel] != "true" {
+		t.Errorf("Expected the Service to select no pod during the migration, got %v", ser.Spec.Selector)
+	}
+	var exported bool
+	for _, command := range executor.Commands() {
+		// Writes are blocked during the export, the rows are counted in the same session
+		if command.Pod.Name == "example-0" && strings.Contains(command.Command, "SET EXCLUSIVE 2; SCRIPT TO") &&
+			strings.Contains(command.Command, "/opt/h2-data/h2-upgrade.sql") && strings.Contains(command.Command, "COUNT(*)") {
+			exported = true
+		}
+	}
+	if !exported {
+		t.Fatalf("Expected the data to be exported from the old pod, got %+v", executor.Commands())
+	}
+	getTestObject(t, h, "", h)
+	if u := h.Status.Upgrade; u == nil || u.Phase != h2v1alpha2.UpgradePhaseImporting || u.Rows != 3 || u.Tables != 1 {
+		t.Fatalf("Expected the migration to be importing 3 rows, got %+v", u)
+	}
+
+	// The new image is started on a fresh data directory
+	if result := reconcileTestH2Database(t, r, h); result.RequeueAfter != upgradeRequeueDelay {
+		t.Errorf("Expected a requeue after %s while the new pod starts, got %+v", upgradeRequeueDelay, result)
+	}
+	sts := &appsv1.StatefulSet{}
+	getTestObject(t, h, "", sts)
+	c := sts.Spec.Template.Spec.Containers[0]
+	subPath := upgradeDataSubPath("oscarfonts/h2:2.1.214")
+	if c.Image != "oscarfonts/h2:2.1.214" || c.VolumeMounts[0].SubPath != subPath {
+		t.Errorf("Expected the new image on %s, got %s on %q", subPath, c.Image, c.VolumeMounts[0].SubPath)
+	}
+
+	pod := createTestPod(t, h, "example-1", "10.0.0.2")
+	setTestPodReady(t, pod, sts.Spec.Template.Annotations[podTemplateHashAnnotation])
+	reconcileTestH2Database(t, r, h)
+	reconcileTestH2Database(t, r, h)
+
+	getTestObject(t, h, "", h)
+	if u := h.Status.Upgrade; u == nil || u.Phase != h2v1alpha2.UpgradePhaseSucceeded {
+		t.Fatalf("Expected the migration to succeed, got %+v", u)
+	}
+	if h.Status.Image != "oscarfonts/h2:2.1.214" || h.Status.DataSubPath != subPath {
+		t.Errorf("Expected the data to be written by the new image in %s, got %s in %q", subPath, h.Status.Image, h.Status.DataSubPath)
+	}
+	var imported bool
+	for _, command := range executor.Commands() {
+		if command.Pod.Name == "example-1" && strings.Contains(command.Command, "RUNSCRIPT FROM") &&
+			strings.Contains(command.Command, "/opt/h2-volume/h2-upgrade.sql") &&
+			strings.HasPrefix(command.Command, "[ -f '/opt/h2-volume/h2-upgrade.imported' ] || ") {
+			imported = true
+		}
+	}
+	if !imported {
+		t.Errorf("Expected the data to be imported once in the new pod, got %+v", executor.Commands())
+	}
+	getTestObject(t, h, "", ser)
+	if _, ok := ser.Spec.Selector[maintenanceSelectorLabel]; ok {
+		t.Errorf("Expected the Service to select the H2 pods after the migration, got %v", ser.Spec.Selector)
+	}
+}
+
+func TestReconcileRollsBackFailedMigration(t *testing.T) {
+	requireEnvironment(t)
+	// A row is lost by the import
+	executor := rowCountExecutor(func(pod *corev1.Pod) int {
+		if pod.Name == "example-1" {
+			return 2
+		}
+		return 3
+	})
+	r := newTestReconciler(executor)
+	h := startTestUpgrade(t, r)
+	reconcileTestH2Database(t, r, h)
+	reconcileTestH2Database(t, r, h)
+	reconcileTestH2Database(t, r, h)
+	sts := &appsv1.StatefulSet{}
+	getTestObject(t, h, "", sts)
+	pod := createTestPod(t, h, "example-1", "10.0.0.2")
+	setTestPodReady(t, pod, sts.Spec.Template.Annotations[podTemplateHashAnnotation])
+	reconcileTestH2Database(t, r, h)
+
+	getTestObject(t, h, "", h)
+	if u := h.Status.Upgrade; u == nil || u.Phase != h2v1alpha2.UpgradePhaseFailed || !strings.Contains(u.Message, "Found 2 rows") {
+		t.Fatalf("Expected the migration to fail on the row counts, got %+v", u)
+	}
+	if !h.Status.Conditions.IsFalseFor(h2v1alpha2.ConditionUpgrading) {
+		t.Errorf("Expected Upgrading to be false, got %+v", h.Status.Conditions)
+	}
+
+	// The old image is restored with its data, and the migration is not tried again
+	reconcileTestH2Database(t, r, h)
+	reconcileTestH2Database(t, r, h)
+	getTestObject(t, h, "", sts)
+	c := sts.Spec.Template.Spec.Containers[0]
+	if c.Image != "oscarfonts/h2:1.4.200" || c.VolumeMounts[0].SubPath != "" {
+		t.Errorf("Expected the old image on the root of the volume, got %s on %q", c.Image, c.VolumeMounts[0].SubPath)
+	}
+	getTestObject(t, h, "", h)
+	if h.Status.Upgrade.Phase != h2v1alpha2.UpgradePhaseFailed || h.Status.Image != "oscarfonts/h2:1.4.200" {
+		t.Errorf("Expected the failed migration to stay rolled back, got %+v", h.Status.Upgrade)
+	}
+}
+
+func TestReconcileRollsBackTimedOutMigration(t *testing.T) {
+	requireEnvironment(t)
+	// The pod can't be reached
+	executor := &fake.PodExecutor{
+		Handler: func(pod *corev1.Pod, command, stdin string) (string, string, error) {
+			return "", "", &RemoteCommandError{Reason: RemoteCommandConnectionError, Err: fmt.Errorf("connection refused")}
+		},
+	}
+	r := newTestReconciler(executor)
+	h := startTestUpgrade(t, r)
+	reconcileTestH2Database(t, r, h)
+	if result := reconcileTestH2Database(t, r, h); result.RequeueAfter != upgradeRequeueDelay {
+		t.Errorf("Expected the export to be retried after %s, got %+v", upgradeRequeueDelay, result)
+	}
+	getTestObject(t, h, "", h)
+	if u := h.Status.Upgrade; u == nil || u.Phase != h2v1alpha2.UpgradePhaseExporting {
+		t.Fatalf("Expected the migration to be exporting, got %+v", u)
+	}
+
+	h.Status.Upgrade.StartTime = metav1.NewTime(h.Status.Upgrade.StartTime.Add(-upgradeTimeout))
+	if err := testClient.Status().Update(context.TODO(), h); err != nil {
+		t.Fatalf("Failed to age the migration: %v", err)
+	}
+	reconcileTestH2Database(t, r, h)
+	getTestObject(t, h, "", h)
+	if u := h.Status.Upgrade; u.Phase != h2v1alpha2.UpgradePhaseFailed || !strings.Contains(u.Message, "did not complete within") {
+		t.Fatalf("Expected the migration to time out, got %+v", u)
+	}
+	reconcileTestH2Database(t, r, h)
+	ser := &corev1.Service{}
+	getTestObject(t, h, "", ser)
+	if _, ok := ser.Spec.Selector[maintenanceSelectorLabel]; ok {
+		t.Errorf("Expected the Service to select the H2 pods after the rollback, got %v", ser.Spec.Selector)
+	}
+}
+
+func TestReconcileRollsBackMigrationWithoutExecPermission(t *testing.T) {
+	requireEnvironment(t)
+	executor := &fake.PodExecutor{
+		Handler: func(pod *corev1.Pod, command, stdin string) (string, string, error) {
+			return "", "", &RemoteCommandError{Reason: RemoteCommandConnectionError,
+				Err: errors.NewForbidden(schema.GroupResource{Resource: "pods"}, pod.Name, fmt.Errorf("cannot create resource pods/exec"))}
+		},
+	}
+	r := newTestReconciler(executor)
+	h := startTestUpgrade(t, r)
+	reconcileTestH2Database(t, r, h)
+	reconcileTestH2Database(t, r, h)
+
+	getTestObject(t, h, "", h)
+	if u := h.Status.Upgrade; u == nil || u.Phase != h2v1alpha2.UpgradePhaseFailed {
+		t.Fatalf("Expected the migration to be rolled back right away, got %+v", u)
+	}
+}
@@ -0,0 +1,133 @@
+package h2database
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// The H2 servers run on Java, which reads its certificates from a keystore rather than from PEM files.
+// The functions below write the JKS format understood by every Java version, as implemented by
+// sun.security.provider.JavaKeyStore.
+
+const (
+	jksMagic   uint32 = 0xfeedfeed
+	jksVersion uint32 = 2
+
+	jksPrivateKeyTag  uint32 = 1
+	jksTrustedCertTag uint32 = 2
+)
+
+// jksKeyProtectorOID identifies the proprietary algorithm protecting the private keys of a JKS keystore
+var jksKeyProtectorOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+// encodeKeyStore returns a JKS keystore holding the PKCS#8 private key along with its DER certificate chain
+func encodeKeyStore(alias string, pkcs8Key []byte, chain [][]byte, password string, now time.Time) ([]byte, error) {
+	protected, err := protectJKSKey(pkcs8Key, password)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	writeJKSHeader(buf, 1)
+	binary.Write(buf, binary.BigEndian, jksPrivateKeyTag)
+	writeJKSUTF(buf, alias)
+	binary.Write(buf, binary.BigEndian, now.UnixNano()/int64(time.Millisecond))
+	writeJKSBytes(buf, protected)
+	binary.Write(buf, binary.BigEndian, uint32(len(chain)))
+	for _, cert := range chain {
+		writeJKSUTF(buf, "X.509")
+		writeJKSBytes(buf, cert)
+	}
+	return signJKS(buf, password), nil
+}
+
+// encodeTrustStore returns a JKS keystore holding the DER certificates as trusted entries
+func encodeTrustStore(alias string, certs [][]byte, password string, now time.Time) []byte {
+	buf := &bytes.Buffer{}
+	writeJKSHeader(buf, len(certs))
+	for i, cert := range certs {
+		binary.Write(buf, binary.BigEndian, jksTrustedCertTag)
+		writeJKSUTF(buf, fmt.Sprintf("%s-%d", alias, i))
+		binary.Write(buf, binary.BigEndian, now.UnixNano()/int64(time.Millisecond))
+		writeJKSUTF(buf, "X.509")
+		writeJKSBytes(buf, cert)
+	}
+	return signJKS(buf, password)
+}
+
+func writeJKSHeader(buf *bytes.Buffer, entries int) {
+	binary.Write(buf, binary.BigEndian, jksMagic)
+	binary.Write(buf, binary.BigEndian, jksVersion)
+	binary.Write(buf, binary.BigEndian, uint32(entries))
+}
+
+// writeJKSUTF writes s like java.io.DataOutput.writeUTF, s is expected to be ASCII
+func writeJKSUTF(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
+
+func writeJKSBytes(buf *bytes.Buffer, b []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(b)))
+	buf.Write(b)
+}
+
+// signJKS appends the integrity digest of the keystore
+func signJKS(buf *bytes.Buffer, password string) []byte {
+	h := sha1.New()
+	h.Write(jksPassword(password))
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(buf.Bytes())
+	buf.Write(h.Sum(nil))
+	return buf.Bytes()
+}
+
+// protectJKSKey encrypts the private key as sun.security.provider.KeyProtector does
+// and wraps it in an EncryptedPrivateKeyInfo
+func protectJKSKey(plain []byte, password string) ([]byte, error) {
+	passwd := jksPassword(password)
+	salt := make([]byte, sha1.Size)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	// The key stream is made of successive SHA-1 digests of the password and the previous digest
+	keyStream := make([]byte, 0, len(plain)+sha1.Size)
+	digest := salt
+	for len(keyStream) < len(plain) {
+		sum := sha1.Sum(append(append([]byte{}, passwd...), digest...))
+		digest = sum[:]
+		keyStream = append(keyStream, digest...)
+	}
+
+	encrypted := make([]byte, 0, len(salt)+len(plain)+sha1.Size)
+	encrypted = append(encrypted, salt...)
+	for i := range plain {
+		encrypted = append(encrypted, plain[i]^keyStream[i])
+	}
+	check := sha1.Sum(append(append([]byte{}, passwd...), plain...))
+	encrypted = append(encrypted, check[:]...)
+
+	return asn1.Marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		Data      []byte
+	}{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: jksKeyProtectorOID, Parameters: asn1.NullRawValue},
+		Data:      encrypted,
+	})
+}
+
+// jksPassword returns the password as the big-endian UTF-16 bytes Java digests
+func jksPassword(password string) []byte {
+	var b []byte
+	for _, c := range password {
+		b = append(b, byte(c>>8), byte(c))
+	}
+	return b
+}
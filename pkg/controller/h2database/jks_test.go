@@ -0,0 +1,218 @@
+package h2database
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+)
+
+// jksEntry is an entry of a JKS keystore as read by readJKS
+type jksEntry struct {
+	tag   uint32
+	alias string
+	date  int64
+	key   []byte
+	certs [][]byte
+}
+
+// readJKS parses a JKS keystore the way sun.security.provider.JavaKeyStore loads it, and checks its integrity digest
+func readJKS(t *testing.T, data []byte, password string) []jksEntry {
+	t.Helper()
+	if len(data) < sha1.Size {
+		t.Fatalf("Expected a keystore, got %d bytes", len(data))
+	}
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	h := sha1.New()
+	h.Write(jksPassword(password))
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(body)
+	if !bytes.Equal(h.Sum(nil), digest) {
+		t.Fatalf("Expected the integrity digest to match the password")
+	}
+
+	r := bytes.NewReader(body)
+	var magic, version, count uint32
+	readJKSValue(t, r, &magic)
+	readJKSValue(t, r, &version)
+	readJKSValue(t, r, &count)
+	if magic != 0xfeedfeed || version != 2 {
+		t.Fatalf("Expected a JKS version 2 keystore, got magic %#x and version %d", magic, version)
+	}
+	var entries []jksEntry
+	for i := uint32(0); i < count; i++ {
+		var e jksEntry
+		readJKSValue(t, r, &e.tag)
+		e.alias = readJKSUTF(t, r)
+		readJKSValue(t, r, &e.date)
+		switch e.tag {
+		case 1:
+			e.key = readJKSBytes(t, r)
+			var certs uint32
+			readJKSValue(t, r, &certs)
+			for j := uint32(0); j < certs; j++ {
+				if certType := readJKSUTF(t, r); certType != "X.509" {
+					t.Fatalf("Expected X.509 certificates, got %q", certType)
+				}
+				e.certs = append(e.certs, readJKSBytes(t, r))
+			}
+		case 2:
+			if certType := readJKSUTF(t, r); certType != "X.509" {
+				t.Fatalf("Expected a X.509 certificate, got %q", certType)
+			}
+			e.certs = append(e.certs, readJKSBytes(t, r))
+		default:
+			t.Fatalf("Unexpected entry tag %d", e.tag)
+		}
+		entries = append(entries, e)
+	}
+	if r.Len() != 0 {
+		t.Fatalf("Expected the digest after the %d entries, got %d more bytes", count, r.Len())
+	}
+	return entries
+}
+
+func readJKSValue(t *testing.T, r io.Reader, v interface{}) {
+	t.Helper()
+	if err := binary.Read(r, binary.BigEndian, v); err != nil {
+		t.Fatalf("Truncated keystore: %v", err)
+	}
+}
+
+func readJKSUTF(t *testing.T, r io.Reader) string {
+	t.Helper()
+	var n uint16
+	readJKSValue(t, r, &n)
+	b := make([]byte, n)
+	readJKSValue(t, r, b)
+	return string(b)
+}
+
+func readJKSBytes(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+	var n uint32
+	readJKSValue(t, r, &n)
+	b := make([]byte, n)
+	readJKSValue(t, r, b)
+	return b
+}
+
+// recoverJKSKey decrypts a key protected by protectJKSKey as sun.security.provider.KeyProtector does
+func recoverJKSKey(t *testing.T, protected []byte, password string) []byte {
+	t.Helper()
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		Data      []byte
+	}
+	if rest, err := asn1.Unmarshal(protected, &info); err != nil || len(rest) != 0 {
+		t.Fatalf("Expected an EncryptedPrivateKeyInfo, got %v with %d trailing bytes", err, len(rest))
+	}
+	if !info.Algorithm.Algorithm.Equal(jksKeyProtectorOID) {
+		t.Fatalf("Expected the key protector algorithm, got %v", info.Algorithm.Algorithm)
+	}
+	if len(info.Data) < 2*sha1.Size {
+		t.Fatalf("Expected a salt and a check digest, got %d bytes", len(info.Data))
+	}
+	passwd := jksPassword(password)
+	salt := info.Data[:sha1.Size]
+	encrypted := info.Data[sha1.Size : len(info.Data)-sha1.Size]
+	check := info.Data[len(info.Data)-sha1.Size:]
+
+	plain := make([]byte, len(encrypted))
+	digest := salt
+	for i := range encrypted {
+		if i%sha1.Size == 0 {
+			sum := sha1.Sum(append(append([]byte{}, passwd...), digest...))
+			digest = sum[:]
+		}
+		plain[i] = encrypted[i] ^ digest[i%sha1.Size]
+	}
+	if sum := sha1.Sum(append(append([]byte{}, passwd...), plain...)); !bytes.Equal(sum[:], check) {
+		t.Fatalf("Expected the check digest of the recovered key to match")
+	}
+	return plain
+}
+
+func TestEncodeKeyStore(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	key := bytes.Repeat([]byte{0x30, 0x81, 0x87, 0x02}, 35)
+	chain := [][]byte{[]byte("serving certificate"), []byte("CA certificate")}
+	data, err := encodeKeyStore("h2", key, chain, "s3cret", now)
+	if err != nil {
+		t.Fatalf("encodeKeyStore failed: %v", err)
+	}
+
+	entries := readJKS(t, data, "s3cret")
+	if len(entries) != 1 {
+		t.Fatalf("Expected a single entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.tag != 1 || e.alias != "h2" || e.date != now.UnixNano()/int64(time.Millisecond) {
+		t.Errorf("Expected a private key entry h2 dated %s, got tag %d, alias %q and date %d", now, e.tag, e.alias, e.date)
+	}
+	if len(e.certs) != 2 || !bytes.Equal(e.certs[0], chain[0]) || !bytes.Equal(e.certs[1], chain[1]) {
+		t.Errorf("Expected the certificate chain in order, got %q", e.certs)
+	}
+	if got := recoverJKSKey(t, e.key, "s3cret"); !bytes.Equal(got, key) {
+		t.Errorf("Expected the protected key to decrypt to the original one, got %x", got)
+	}
+}
+
+func TestEncodeTrustStore(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	certs := [][]byte{[]byte("old CA"), []byte("new CA")}
+	entries := readJKS(t, encodeTrustStore("ca", certs, "s3cret", now), "s3cret")
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	for i, e := range entries {
+		if e.tag != 2 || e.alias != []string{"ca-0", "ca-1"}[i] || !bytes.Equal(e.certs[0], certs[i]) {
+			t.Errorf("Expected the trusted certificate %q as ca-%d, got tag %d, alias %q and %q", certs[i], i, e.tag, e.alias, e.certs)
+		}
+	}
+
+	if entries := readJKS(t, encodeTrustStore("ca", nil, "s3cret", now), "s3cret"); len(entries) != 0 {
+		t.Errorf("Expected an empty trust store, got %d entries", len(entries))
+	}
+}
+
+func TestProtectJKSKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      []byte
+		password string
+	}{
+		{"shorter than a digest", []byte("short key"), "s3cret"},
+		{"multiple of a digest", bytes.Repeat([]byte{0xab}, 2*sha1.Size), "s3cret"},
+		{"longer than a digest", bytes.Repeat([]byte{0x01, 0x02, 0x03}, 50), "s3cret"},
+		{"non-ASCII password", []byte("private key"), "pässwörd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protected, err := protectJKSKey(tt.key, tt.password)
+			if err != nil {
+				t.Fatalf("protectJKSKey failed: %v", err)
+			}
+			if got := recoverJKSKey(t, protected, tt.password); !bytes.Equal(got, tt.key) {
+				t.Errorf("Expected the key to be recovered, got %x", got)
+			}
+			again, err := protectJKSKey(tt.key, tt.password)
+			if err != nil {
+				t.Fatalf("protectJKSKey failed: %v", err)
+			}
+			if bytes.Equal(again, protected) {
+				t.Errorf("Expected a random salt for every key")
+			}
+		})
+	}
+}
+
+func TestJKSPassword(t *testing.T) {
+	if got, want := jksPassword("aé"), []byte{0x00, 'a', 0x00, 0xe9}; !bytes.Equal(got, want) {
+		t.Errorf("Expected the UTF-16 bytes %x, got %x", want, got)
+	}
+}
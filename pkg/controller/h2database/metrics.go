@@ -0,0 +1,149 @@
+package h2database
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/exporter"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// h2MetricsPort is the port of the exporter sidecar
+const h2MetricsPort = exporter.DefaultPort
+
+// exporterImageEnvVar names the environment variable of the operator holding the default exporter image,
+// which is the operator image itself
+const exporterImageEnvVar = "H2_EXPORTER_IMAGE"
+
+// defaultExporterImage is used when neither the spec nor the operator environment set the exporter image
+const defaultExporterImage = "pwegrzyndocking/kubernetes-operators-project"
+
+// serviceMonitorGVK is the ServiceMonitor API of the Prometheus Operator, which may not be installed
+var serviceMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}
+
+// exporterImage returns the image of the exporter sidecar of the given H2 CR
+func exporterImage(h *h2v1alpha2.H2Database) string {
+	if h.Spec.Metrics.Image != "" {
+		return h.Spec.Metrics.Image
+	}
+	if image := os.Getenv(exporterImageEnvVar); image != "" {
+		return image
+	}
+	return defaultExporterImage
+}
+
+// exporterContainerForH2Database returns the exporter sidecar, it logs in with the admin credentials
+// and reads the size of the database file from the data volume mounted read-only
+func exporterContainerForH2Database(h *h2v1alpha2.H2Database) corev1.Container {
+	args := []string{
+		"--listen-address", fmt.Sprintf(":%d", h2MetricsPort),
+		"--pg-address", fmt.Sprintf("localhost:%d", h2PGPort),
+		"--database", h.Spec.Database,
+		"--data-dir", h2DataDir,
+	}
+	if h.Spec.Metrics.QueryStatistics {
+		args = append(args, "--query-statistics")
+	}
+	return corev1.Container{
+		Image:           exporterImage(h),
+		Name:            "exporter",
+		Command:         []string{"kubernetes-operators-project", exporter.Command},
+		Args:            args,
+		Env:             credentialsEnvForH2Database(h),
+		Ports:           []corev1.ContainerPort{{ContainerPort: h2MetricsPort, Name: "metrics"}},
+		SecurityContext: containerSecurityContextForH2Database(h),
+		VolumeMounts:    []corev1.VolumeMount{dataVolumeMountForH2Database(h, true)},
+	}
+}
+
+// metricsName returns the name of the Service and the ServiceMonitor of the exporter of the given H2 CR
+func metricsName(h *h2v1alpha2.H2Database) string {
+	return h.Name + "-metrics"
+}
+
+// reconcileMetrics makes sure the Service of the exporter of the given H2 CR and the ServiceMonitor scraping it
+// match the spec, and deletes them when the metrics are disabled. The ServiceMonitor is skipped if the
+// Prometheus Operator is not installed.
+// NOTE: The exporter has its own ClusterIP Service, so that the metrics are never exposed by the node ports
+// or the load balancer of the H2 Service.
+func (r *ReconcileH2Database) reconcileMetrics(h *h2v1alpha2.H2Database) error {
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name)
+
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(serviceMonitorGVK)
+	sm.SetName(metricsName(h))
+	sm.SetNamespace(h.Namespace)
+
+	if !h.Spec.Metrics.Enabled {
+		if err := r.deleteOwned(h, &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: metricsName(h), Namespace: h.Namespace}}); err != nil {
+			return err
+		}
+		return r.deleteOwned(h, sm)
+	}
+
+	ser := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: metricsName(h), Namespace: h.Namespace}}
+	_, err := controllerutil.CreateOrUpdate(context.TODO(), r.client, ser, func() error {
+		ser.Labels = metricsLabelsForH2Database(h)
+		ser.Spec.Selector = labelsForH2Database(h.Name)
+		// The defaulted fields are set explicitly, so that the Service is not updated every time
+		ser.Spec.Ports = []corev1.ServicePort{{
+			Name:       "metrics",
+			Protocol:   corev1.ProtocolTCP,
+			Port:       h2MetricsPort,
+			TargetPort: intstr.FromInt(int(h2MetricsPort)),
+		}}
+		return controllerutil.SetControllerReference(h, ser, r.scheme)
+	})
+	if err != nil {
+		reqLogger.Error(err, "Failed to ensure the metrics Service.", "Service.Namespace", ser.Namespace, "Service.Name", ser.Name)
+		return err
+	}
+
+	_, err = controllerutil.CreateOrUpdate(context.TODO(), r.client, sm, func() error {
+		sm.SetLabels(labelsForH2Database(h.Name))
+		sm.Object["spec"] = map[string]interface{}{
+			"selector": map[string]interface{}{
+				"matchLabels": stringMapToInterface(metricsLabelsForH2Database(h)),
+			},
+			"endpoints": []interface{}{
+				map[string]interface{}{
+					"port":     "metrics",
+					"interval": h.Spec.Metrics.Interval,
+				},
+			},
+		}
+		return controllerutil.SetControllerReference(h, sm, r.scheme)
+	})
+	if err != nil && meta.IsNoMatchError(err) {
+		reqLogger.Info("Skipping the ServiceMonitor, the Prometheus Operator is not installed.")
+		return nil
+	}
+	if err != nil {
+		reqLogger.Error(err, "Failed to ensure the ServiceMonitor.", "ServiceMonitor.Namespace", h.Namespace, "ServiceMonitor.Name", sm.GetName())
+	}
+	return err
+}
+
+// metricsLabelsForH2Database returns the labels of the metrics Service, selected by the ServiceMonitor
+func metricsLabelsForH2Database(h *h2v1alpha2.H2Database) map[string]string {
+	ls := labelsForH2Database(h.Name)
+	ls["h2database_metrics"] = "true"
+	return ls
+}
+
+// stringMapToInterface converts labels for an unstructured object
+func stringMapToInterface(m map[string]string) map[string]interface{} {
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
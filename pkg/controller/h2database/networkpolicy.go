@@ -0,0 +1,94 @@
+package h2database
+
+import (
+	"context"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// namespaceNameLabel is set on every namespace by Kubernetes 1.21+
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+// reconcileNetworkPolicy makes sure the NetworkPolicy of the given H2 CR matches the spec,
+// and deletes it when the policy is disabled
+func (r *ReconcileH2Database) reconcileNetworkPolicy(h *h2v1alpha2.H2Database) error {
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name)
+
+	if !h.Spec.NetworkPolicy.Enabled {
+		return r.deleteOwned(h, &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: h.Name, Namespace: h.Namespace}})
+	}
+
+	policy := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: h.Name, Namespace: h.Namespace}}
+	op, err := controllerutil.CreateOrUpdate(context.TODO(), r.client, policy, func() error {
+		policy.Labels = labelsForH2Database(h.Name)
+		policy.Spec = networkPolicySpecForH2Database(h)
+		return controllerutil.SetControllerReference(h, policy, r.scheme)
+	})
+	if err != nil {
+		reqLogger.Error(err, "Failed to ensure the NetworkPolicy.", "NetworkPolicy.Namespace", policy.Namespace, "NetworkPolicy.Name", policy.Name)
+		return err
+	}
+	if op != controllerutil.OperationResultNone {
+		reqLogger.Info("Reconciled the NetworkPolicy.", "NetworkPolicy.Namespace", policy.Namespace, "NetworkPolicy.Name", policy.Name, "Operation", op)
+	}
+	return nil
+}
+
+// networkPolicySpecForH2Database returns a policy only letting the clients listed in the spec, the other H2 pods
+// of the database (needed by clustering) and the operator connect to the H2 ports and the metrics port
+func networkPolicySpecForH2Database(h *h2v1alpha2.H2Database) networkingv1.NetworkPolicySpec {
+	peers := append([]networkingv1.NetworkPolicyPeer{{
+		PodSelector: &metav1.LabelSelector{MatchLabels: labelsForH2Database(h.Name)},
+	}}, h.Spec.NetworkPolicy.From...)
+	if operator := operatorPeer(h.Namespace); operator != nil {
+		peers = append(peers, *operator)
+	}
+
+	var ports []networkingv1.NetworkPolicyPort
+	containerPorts := containerPortsForH2Database(h)
+	if h.Spec.Metrics.Enabled {
+		containerPorts = append(containerPorts, corev1.ContainerPort{ContainerPort: h2MetricsPort})
+	}
+	for _, p := range containerPorts {
+		port := intstr.FromInt(int(p.ContainerPort))
+		// The protocol is set explicitly, otherwise the defaulting of the API server would cause an update every time
+		protocol := corev1.ProtocolTCP
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+	}
+
+	return networkingv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{MatchLabels: labelsForH2Database(h.Name)},
+		Ingress: []networkingv1.NetworkPolicyIngressRule{{
+			From:  peers,
+			Ports: ports,
+		}},
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+	}
+}
+
+// operatorPeer returns the peer selecting the operator pod, or nil when the operator runs outside the cluster
+// NOTE: Remote commands go through the API server, the operator pod only needs to be allowed
+// for the connections it opens itself.
+func operatorPeer(namespace string) *networkingv1.NetworkPolicyPeer {
+	name, err := k8sutil.GetOperatorName()
+	if err != nil {
+		return nil
+	}
+	operatorNs, err := k8sutil.GetOperatorNamespace()
+	if err != nil {
+		return nil
+	}
+	peer := &networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"name": name}},
+	}
+	if operatorNs != namespace {
+		peer.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{namespaceNameLabel: operatorNs}}
+	}
+	return peer
+}
@@ -0,0 +1,152 @@
+package h2database
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Metrics of the operator, served with the controller-runtime metrics on the metrics endpoint of the manager
+var (
+	reconcileStepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "h2_operator_reconcile_step_duration_seconds",
+		Help: "Duration of the steps of the reconciliation of H2Databases.",
+	}, []string{"step"})
+
+	backupAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "h2_operator_backup_attempts_total",
+		Help: "Backups started.",
+	}, []string{"namespace", "name"})
+	backupSuccesses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "h2_operator_backup_successes_total",
+		Help: "Backups posted successfully.",
+	}, []string{"namespace", "name"})
+	backupFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "h2_operator_backup_failures_total",
+		Help: "Backups that failed.",
+	}, []string{"namespace", "name"})
+	backupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "h2_operator_backup_duration_seconds",
+		Help:    "Duration of the backups, successful or not.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"namespace", "name"})
+	backupSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "h2_operator_backup_size_bytes",
+		Help: "Size of the last successful backup.",
+	}, []string{"namespace", "name"})
+	backupLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "h2_operator_backup_last_success_timestamp_seconds",
+		Help: "Time of the last successful backup.",
+	}, []string{"namespace", "name"})
+
+	clusterState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "h2_operator_cluster_state",
+		Help: "Cluster state of the H2Databases, 1 for the current state and 0 for the others.",
+	}, []string{"namespace", "name", "state"})
+
+	remoteCommandFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "h2_operator_remote_command_failures_total",
+		Help: "Remote commands run in the H2 pods that failed, by operation.",
+	}, []string{"namespace", "name", "operation"})
+)
+
+// h2DatabaseOperations lists the values of the operation label of the remote command failures of H2Databases
+var h2DatabaseOperations = []string{
+	operationBackup,
+	operationCreateCluster,
+	operationUpgradeExport,
+	operationUpgradeImport,
+	operationUpgradeCleanup,
+	operationUpgradeTables,
+	operationUpgradeRowCount,
+}
+
+// clusterStates lists the values of the cluster state gauge
+var clusterStates = []h2v1alpha2.ClusterState{
+	h2v1alpha2.ClusterStateDisabled,
+	h2v1alpha2.ClusterStatePending,
+	h2v1alpha2.ClusterStateFormed,
+	h2v1alpha2.ClusterStateFailed,
+}
+
+func init() {
+	metrics.Registry.MustRegister(
+		reconcileStepDuration,
+		backupAttempts, backupSuccesses, backupFailures, backupDuration, backupSize, backupLastSuccess,
+		clusterState,
+		remoteCommandFailures,
+	)
+}
+
+// stepTimer observes the duration of consecutive reconciliation steps
+type stepTimer struct {
+	last time.Time
+}
+
+func newStepTimer() *stepTimer {
+	return &stepTimer{last: time.Now()}
+}
+
+// done records the time elapsed since the previous step as the duration of the given step
+func (t *stepTimer) done(step string) {
+	now := time.Now()
+	reconcileStepDuration.WithLabelValues(step).Observe(now.Sub(t.last).Seconds())
+	t.last = now
+}
+
+// backupSizePattern matches the line printed by the backup command with the size of the backup
+var backupSizePattern = regexp.MustCompile(`backup-size: *([0-9]+)`)
+
+// recordBackup records the outcome of a backup of the given H2 CR, the size is read from its output
+func recordBackup(h *h2v1alpha2.H2Database, stdout string, duration time.Duration, err error) {
+	backupAttempts.WithLabelValues(h.Namespace, h.Name).Inc()
+	backupDuration.WithLabelValues(h.Namespace, h.Name).Observe(duration.Seconds())
+	if err != nil {
+		backupFailures.WithLabelValues(h.Namespace, h.Name).Inc()
+		return
+	}
+	backupSuccesses.WithLabelValues(h.Namespace, h.Name).Inc()
+	backupLastSuccess.WithLabelValues(h.Namespace, h.Name).SetToCurrentTime()
+	if m := backupSizePattern.FindStringSubmatch(stdout); m != nil {
+		if size, err := strconv.ParseFloat(m[1], 64); err == nil {
+			backupSize.WithLabelValues(h.Namespace, h.Name).Set(size)
+		}
+	}
+}
+
+// recordClusterState sets the cluster state gauge of the given H2 CR
+func recordClusterState(h *h2v1alpha2.H2Database) {
+	for _, state := range clusterStates {
+		value := 0.0
+		if h.Status.ClusterState == state {
+			value = 1
+		}
+		clusterState.WithLabelValues(h.Namespace, h.Name, string(state)).Set(value)
+	}
+}
+
+// forgetH2Database removes the series of a deleted H2 CR
+func forgetH2Database(namespace, name string) {
+	for _, vec := range []*prometheus.CounterVec{backupAttempts, backupSuccesses, backupFailures} {
+		vec.DeleteLabelValues(namespace, name)
+	}
+	backupDuration.DeleteLabelValues(namespace, name)
+	backupSize.DeleteLabelValues(namespace, name)
+	backupLastSuccess.DeleteLabelValues(namespace, name)
+	for _, state := range clusterStates {
+		clusterState.DeleteLabelValues(namespace, name, string(state))
+	}
+	ForgetRemoteCommandFailures(namespace, name, h2DatabaseOperations...)
+}
+
+// ForgetRemoteCommandFailures removes the remote command failures series of a deleted object for the given
+// operations, the ones of other kinds of objects with the same name are left alone
+func ForgetRemoteCommandFailures(namespace, name string, operations ...string) {
+	for _, operation := range operations {
+		remoteCommandFailures.DeleteLabelValues(namespace, name, operation)
+	}
+}
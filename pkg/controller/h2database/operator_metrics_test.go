@@ -0,0 +1,22 @@
+package h2database
+
+import "testing"
+
+func TestForgetH2DatabaseRemovesRemoteCommandFailures(t *testing.T) {
+	for _, operation := range h2DatabaseOperations {
+		remoteCommandFailures.WithLabelValues("default", "example", operation).Inc()
+	}
+	// The series of an H2User with the same name are not the H2Database's
+	remoteCommandFailures.WithLabelValues("default", "example", "apply-user").Inc()
+	defer remoteCommandFailures.DeleteLabelValues("default", "example", "apply-user")
+
+	forgetH2Database("default", "example")
+	for _, operation := range h2DatabaseOperations {
+		if remoteCommandFailures.DeleteLabelValues("default", "example", operation) {
+			t.Errorf("Expected the %s failures of the deleted H2Database to be removed", operation)
+		}
+	}
+	if !remoteCommandFailures.DeleteLabelValues("default", "example", "apply-user") {
+		t.Error("Expected the failures of the H2User to be kept")
+	}
+}
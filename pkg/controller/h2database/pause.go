@@ -0,0 +1,82 @@
+package h2database
+
+import (
+	"context"
+
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Annotations letting admins take over a H2 CR during manual interventions
+const (
+	// pausedAnnotation set to "true" stops the operator from changing anything for the H2 CR
+	pausedAnnotation = "h2.example.com/paused"
+	// maintenanceAnnotation set to "true" takes the H2 pods out of the Service, the database keeps running
+	maintenanceAnnotation = "h2.example.com/maintenance"
+)
+
+// maintenanceSelectorLabel is added to the selector of the Service in maintenance mode, no pod has it
+const maintenanceSelectorLabel = "h2.example.com/maintenance"
+
+// Reasons of the Paused and Maintenance conditions
+const (
+	reasonPausedAnnotation      status.ConditionReason = "PausedAnnotation"
+	reasonMaintenanceAnnotation status.ConditionReason = "MaintenanceAnnotation"
+)
+
+// IsPaused returns true if the operators should leave the given H2 CR and its database alone
+func IsPaused(h *h2v1alpha2.H2Database) bool {
+	return h.Annotations[pausedAnnotation] == "true"
+}
+
+// inMaintenance returns true if the H2 pods of the given H2 CR should be taken out of the Service
+func inMaintenance(h *h2v1alpha2.H2Database) bool {
+	return h.Annotations[maintenanceAnnotation] == "true"
+}
+
+// reportPaused sets the Paused condition of the given paused H2 CR, the only change made while it is paused
+func (r *ReconcileH2Database) reportPaused(h *h2v1alpha2.H2Database) (reconcile.Result, error) {
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name)
+	reqLogger.Info("Skipping the reconciliation of a paused H2Database.")
+	if h.Status.Conditions.IsTrueFor(h2v1alpha2.ConditionPaused) {
+		return reconcile.Result{}, nil
+	}
+	h.Status.Conditions.SetCondition(status.Condition{
+		Type:    h2v1alpha2.ConditionPaused,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasonPausedAnnotation,
+		Message: "The reconciliation is paused by the " + pausedAnnotation + " annotation",
+	})
+	err := r.client.Status().Update(context.TODO(), h)
+	if err != nil {
+		reqLogger.Error(err, "Failed to update H2Database status.")
+		return reconcile.Result{}, err
+	}
+	r.recorder.Event(h, corev1.EventTypeNormal, eventReasonPaused, "Reconciliation paused")
+	return reconcile.Result{}, nil
+}
+
+// setResumedConditions removes the Paused condition of the given H2 CR and sets its Maintenance condition
+// from the maintenance annotation, recording an Event when they change
+func (r *ReconcileH2Database) setResumedConditions(h *h2v1alpha2.H2Database) {
+	if h.Status.Conditions.RemoveCondition(h2v1alpha2.ConditionPaused) {
+		r.recorder.Event(h, corev1.EventTypeNormal, eventReasonResumed, "Reconciliation resumed")
+	}
+	if !inMaintenance(h) {
+		if h.Status.Conditions.RemoveCondition(h2v1alpha2.ConditionMaintenance) {
+			r.recorder.Event(h, corev1.EventTypeNormal, eventReasonMaintenance, "Maintenance ended, the H2 pods are back in the Service")
+		}
+		return
+	}
+	if !h.Status.Conditions.IsTrueFor(h2v1alpha2.ConditionMaintenance) {
+		r.recorder.Event(h, corev1.EventTypeNormal, eventReasonMaintenance, "Maintenance started, the H2 pods are taken out of the Service")
+	}
+	h.Status.Conditions.SetCondition(status.Condition{
+		Type:    h2v1alpha2.ConditionMaintenance,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasonMaintenanceAnnotation,
+		Message: "The H2 pods are taken out of the Service by the " + maintenanceAnnotation + " annotation",
+	})
+}
@@ -0,0 +1,58 @@
+package h2database
+
+import (
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Defaults of the probes of the H2 container
+// NOTE: The readiness probe starts a JVM running the H2 Shell tool, hence its long period and timeout.
+var (
+	defaultStartupProbe   = h2v1alpha2.H2DatabaseProbe{PeriodSeconds: 5, TimeoutSeconds: 1, FailureThreshold: 60}
+	defaultReadinessProbe = h2v1alpha2.H2DatabaseProbe{PeriodSeconds: 30, TimeoutSeconds: 20, FailureThreshold: 3}
+	defaultLivenessProbe  = h2v1alpha2.H2DatabaseProbe{PeriodSeconds: 20, TimeoutSeconds: 5, FailureThreshold: 6}
+)
+
+// probesForH2Database returns the startup, readiness and liveness probes of the H2 container
+func probesForH2Database(h *h2v1alpha2.H2Database) (*corev1.Probe, *corev1.Probe, *corev1.Probe) {
+	// The first enabled server is checked, which is the TCP server unless it is disabled
+	ports := containerPortsForH2Database(h)
+	if len(ports) == 0 {
+		return nil, nil, nil
+	}
+	tcpSocket := corev1.Handler{
+		TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(int(ports[0].ContainerPort))},
+	}
+
+	// Without the TCP server the database can't be reached from another process, so readiness
+	// falls back to the server accepting connections
+	readiness := tcpSocket
+	if h.HasServerMode(h2v1alpha2.ServerModeTCP) {
+		readiness = corev1.Handler{
+			Exec: &corev1.ExecAction{Command: []string{"/bin/sh", "-c", SQLShellCommand(h, "SELECT 1")}},
+		}
+	}
+
+	return probe(tcpSocket, h.Spec.Probes.Startup, defaultStartupProbe),
+		probe(readiness, h.Spec.Probes.Readiness, defaultReadinessProbe),
+		probe(tcpSocket, h.Spec.Probes.Liveness, defaultLivenessProbe)
+}
+
+// probe returns a probe with the handler and the thresholds of the spec, or the defaults for those left out
+func probe(handler corev1.Handler, spec, defaults h2v1alpha2.H2DatabaseProbe) *corev1.Probe {
+	or := func(v, def int32) int32 {
+		if v == 0 {
+			return def
+		}
+		return v
+	}
+	return &corev1.Probe{
+		Handler:             handler,
+		InitialDelaySeconds: or(spec.InitialDelaySeconds, defaults.InitialDelaySeconds),
+		PeriodSeconds:       or(spec.PeriodSeconds, defaults.PeriodSeconds),
+		TimeoutSeconds:      or(spec.TimeoutSeconds, defaults.TimeoutSeconds),
+		FailureThreshold:    or(spec.FailureThreshold, defaults.FailureThreshold),
+		SuccessThreshold:    1,
+	}
+}
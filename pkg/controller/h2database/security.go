@@ -0,0 +1,60 @@
+package h2database
+
+import (
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// h2TmpDir is the writable scratch directory of the H2 containers, backed by an emptyDir
+// since the root filesystem is read-only
+const h2TmpDir = "/tmp"
+
+// seccompPodAnnotation selects the seccomp profile of the pod
+// NOTE: The Kubernetes API this operator is built against has no seccompProfile field yet,
+// newer API servers copy the annotation into the field when the pod is created.
+const seccompPodAnnotation = "seccomp.security.alpha.kubernetes.io/pod"
+
+// podSecurityContextForH2Database returns the security context of the H2 pods, the data volume is owned by FSGroup
+func podSecurityContextForH2Database(h *h2v1alpha2.H2Database) *corev1.PodSecurityContext {
+	sc := h.Spec.SecurityContext
+	psc := &corev1.PodSecurityContext{
+		RunAsUser:  sc.RunAsUser,
+		RunAsGroup: sc.FSGroup,
+		FSGroup:    sc.FSGroup,
+	}
+	if !sc.AllowRoot {
+		nonRoot := true
+		psc.RunAsNonRoot = &nonRoot
+	}
+	return psc
+}
+
+// containerSecurityContextForH2Database returns the security context of the H2 containers
+func containerSecurityContextForH2Database(h *h2v1alpha2.H2Database) *corev1.SecurityContext {
+	sc := h.Spec.SecurityContext
+	noEscalation := false
+	readOnly := !sc.WritableRootFilesystem
+	csc := &corev1.SecurityContext{
+		AllowPrivilegeEscalation: &noEscalation,
+		ReadOnlyRootFilesystem:   &readOnly,
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+	}
+	if !sc.AllowRoot {
+		nonRoot := true
+		csc.RunAsNonRoot = &nonRoot
+	}
+	return csc
+}
+
+// tmpVolumeForH2Database returns the volume mounted at the scratch directory of the H2 containers
+func tmpVolumeForH2Database() (corev1.Volume, corev1.VolumeMount) {
+	return corev1.Volume{
+		Name:         "tmp",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	}, corev1.VolumeMount{
+		Name:      "tmp",
+		MountPath: h2TmpDir,
+	}
+}
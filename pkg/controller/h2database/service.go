@@ -0,0 +1,90 @@
+package h2database
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// managedAnnotationsAnnotation lists the Service annotations set from the spec, so that the ones
+// removed from the spec can be told apart from the ones added by cloud controllers
+const managedAnnotationsAnnotation = "h2.example.com/managed-annotations"
+
+// applyServiceSpec renders the H2 CR spec into the Service and returns true if it changed.
+// The fields allocated by the API server, like the cluster IP and the node ports not fixed in the spec, are kept.
+func applyServiceSpec(ser *corev1.Service, h *h2v1alpha2.H2Database) bool {
+	original := ser.DeepCopy()
+	spec := h.Spec.Service
+
+	// Replace the annotations set from the spec the last time
+	annotations := map[string]string{}
+	for k, v := range ser.Annotations {
+		annotations[k] = v
+	}
+	for _, k := range strings.Split(annotations[managedAnnotationsAnnotation], ",") {
+		delete(annotations, k)
+	}
+	delete(annotations, managedAnnotationsAnnotation)
+	var managed []string
+	for k, v := range spec.Annotations {
+		annotations[k] = v
+		managed = append(managed, k)
+	}
+	if len(managed) > 0 {
+		sort.Strings(managed)
+		annotations[managedAnnotationsAnnotation] = strings.Join(managed, ",")
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	ser.Annotations = annotations
+
+	ser.Spec.Type = spec.Type
+	ser.Spec.Selector = labelsForH2Database(h.Name)
+	if inMaintenance(h) || UpgradeInProgress(h) {
+		// Selecting no pod leaves the Service without endpoints
+		ser.Spec.Selector[maintenanceSelectorLabel] = "true"
+	}
+	ports := servicePortsForH2Database(h)
+	if spec.Type == corev1.ServiceTypeNodePort || spec.Type == corev1.ServiceTypeLoadBalancer {
+		for i := range ports {
+			ports[i].NodePort = fixedNodePort(spec.NodePorts, ports[i].Name)
+			if ports[i].NodePort != 0 {
+				continue
+			}
+			for _, p := range ser.Spec.Ports {
+				if p.Name == ports[i].Name {
+					ports[i].NodePort = p.NodePort
+				}
+			}
+		}
+	} else {
+		// These fields are only valid for NodePort and LoadBalancer Services
+		ser.Spec.ExternalTrafficPolicy = ""
+		ser.Spec.HealthCheckNodePort = 0
+	}
+	ser.Spec.Ports = ports
+	if spec.Type == corev1.ServiceTypeLoadBalancer {
+		ser.Spec.LoadBalancerSourceRanges = spec.LoadBalancerSourceRanges
+	} else {
+		ser.Spec.LoadBalancerSourceRanges = nil
+	}
+
+	return !reflect.DeepEqual(original.Annotations, ser.Annotations) || !reflect.DeepEqual(original.Spec, ser.Spec)
+}
+
+// fixedNodePort returns the node port fixed in the spec for the Service port with the given name, or zero
+func fixedNodePort(nodePorts h2v1alpha2.H2DatabaseNodePorts, name string) int32 {
+	switch name {
+	case "tcp":
+		return nodePorts.TCP
+	case "pg":
+		return nodePorts.PG
+	case "web":
+		return nodePorts.Web
+	}
+	return 0
+}
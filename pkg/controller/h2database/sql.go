@@ -0,0 +1,60 @@
+package h2database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SQLShellCommand returns the shell command running the SQL script against the database of the
+// given H2 CR as its admin user. It is meant to be executed in one of the H2 pods, which expose
+// the admin credentials as $H2_USER and $H2_PASSWORD.
+func SQLShellCommand(h *h2v1alpha2.H2Database, script string) string {
+	return fmt.Sprintf("java -cp /opt/h2/bin/h2*.jar org.h2.tools.Shell -url %s "+
+		"-user \"$H2_USER\" -password \"$H2_PASSWORD\" -sql %s", jdbcURL("localhost", h), ShellQuote(script))
+}
+
+// SQLScriptCommand returns the shell command running the SQL script read from its standard input against the
+// database of the given H2 CR as its admin user, like SQLShellCommand. The script is kept out of the command line,
+// so it may hold passwords.
+// NOTE: RunScript is used rather than Shell, which exits successfully even when the statements read from its
+// standard input fail.
+func SQLScriptCommand(h *h2v1alpha2.H2Database) string {
+	return fmt.Sprintf("java -cp /opt/h2/bin/h2*.jar org.h2.tools.RunScript -url %s "+
+		"-user \"$H2_USER\" -password \"$H2_PASSWORD\" -script /dev/stdin", jdbcURL("localhost", h))
+}
+
+// ListRunningPods returns the running H2 pods of the given H2 CR sorted by name
+func ListRunningPods(c client.Client, h *h2v1alpha2.H2Database) ([]corev1.Pod, error) {
+	podList := &corev1.PodList{}
+	listOpts := []client.ListOption{
+		client.InNamespace(h.Namespace),
+		client.MatchingLabels(labelsForH2Database(h.Name)),
+	}
+	if err := c.List(context.TODO(), podList, listOpts...); err != nil {
+		return nil, err
+	}
+	var pods []corev1.Pod
+	for _, pod := range podList.Items {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			pods = append(pods, pod)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods, nil
+}
+
+// QuoteSQLString returns s as a SQL string literal
+func QuoteSQLString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// ShellQuote returns s quoted for a POSIX shell
+func ShellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
@@ -0,0 +1,194 @@
+package h2database
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Reasons of the H2Database status conditions
+const (
+	reasonClaimBound          status.ConditionReason = "ClaimBound"
+	reasonClaimNotBound       status.ConditionReason = "ClaimNotBound"
+	reasonInstancesAvailable  status.ConditionReason = "InstancesAvailable"
+	reasonNoInstanceAvailable status.ConditionReason = "NoInstanceAvailable"
+	reasonRollingOut          status.ConditionReason = "RollingOut"
+	reasonRolledOut           status.ConditionReason = "RolledOut"
+	reasonRolloutFailed       status.ConditionReason = "RolloutFailed"
+	reasonClusterFormed       status.ConditionReason = "ClusterFormed"
+	reasonClusterPending      status.ConditionReason = "ClusterPending"
+	reasonClusteringDisabled  status.ConditionReason = "ClusteringDisabled"
+	reasonBackupPosted        status.ConditionReason = "BackupPosted"
+)
+
+// Suffixes of the reasons of the conditions set when a remote command failed, by failure
+var remoteCommandReasonSuffixes = map[RemoteCommandFailure]string{
+	RemoteCommandConnectionError: "ConnectionFailed",
+	RemoteCommandStreamError:     "Interrupted",
+	RemoteCommandExitError:       "CommandFailed",
+	RemoteCommandTimeout:         "TimedOut",
+}
+
+// remoteCommandReason returns the reason of a condition set when the remote command of an operation failed,
+// e.g. BackupTimedOut
+func remoteCommandReason(operation string, err error) status.ConditionReason {
+	return status.ConditionReason(operation + remoteCommandReasonSuffixes[remoteCommandFailure(err)])
+}
+
+// remoteCommandMessage describes the failure of a remote command along with the end of its error output
+func remoteCommandMessage(err error) string {
+	var rcErr *RemoteCommandError
+	if errors.As(err, &rcErr) && rcErr.Stderr != "" {
+		return fmt.Sprintf("%v: %s", err, rcErr.Stderr)
+	}
+	return err.Error()
+}
+
+// setStorageCondition sets the StorageReady condition from the phase of the data volume claims of the instances
+func setStorageCondition(h *h2v1alpha2.H2Database, claims []corev1.PersistentVolumeClaim) {
+	bound := map[string]bool{}
+	for _, claim := range claims {
+		bound[claim.Name] = claim.Status.Phase == corev1.ClaimBound
+	}
+	for ordinal := int32(0); ordinal < *h.Spec.Size; ordinal++ {
+		if name := dataVolumeClaimName(h, ordinal); !bound[name] {
+			h.Status.Conditions.SetCondition(status.Condition{
+				Type:    h2v1alpha2.ConditionStorageReady,
+				Status:  corev1.ConditionFalse,
+				Reason:  reasonClaimNotBound,
+				Message: fmt.Sprintf("PersistentVolumeClaim %s is not bound yet", name),
+			})
+			return
+		}
+	}
+	h.Status.Conditions.SetCondition(status.Condition{
+		Type:    h2v1alpha2.ConditionStorageReady,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasonClaimBound,
+		Message: fmt.Sprintf("The PersistentVolumeClaims of the %d H2 instances are bound", *h.Spec.Size),
+	})
+}
+
+// setStatefulSetConditions sets the Available and Progressing conditions from the status of the H2 StatefulSet
+// and of its pods
+func setStatefulSetConditions(h *h2v1alpha2.H2Database, sts *appsv1.StatefulSet, pods []corev1.Pod) {
+	size := *h.Spec.Size
+	ready := sts.Status.ReadyReplicas
+
+	if ready > 0 {
+		h.Status.Conditions.SetCondition(status.Condition{
+			Type:    h2v1alpha2.ConditionAvailable,
+			Status:  corev1.ConditionTrue,
+			Reason:  reasonInstancesAvailable,
+			Message: fmt.Sprintf("%d/%d H2 instances available", ready, size),
+		})
+	} else {
+		h.Status.Conditions.SetCondition(status.Condition{
+			Type:    h2v1alpha2.ConditionAvailable,
+			Status:  corev1.ConditionFalse,
+			Reason:  reasonNoInstanceAvailable,
+			Message: fmt.Sprintf("0/%d H2 instances available", size),
+		})
+	}
+
+	if pod, reason := failedPod(pods); pod != "" {
+		h.Status.Conditions.SetCondition(status.Condition{
+			Type:    h2v1alpha2.ConditionProgressing,
+			Status:  corev1.ConditionFalse,
+			Reason:  reasonRolloutFailed,
+			Message: fmt.Sprintf("Pod %s of StatefulSet %s cannot start: %s", pod, sts.Name, reason),
+		})
+	} else if statefulSetRollingOut(sts) {
+		h.Status.Conditions.SetCondition(status.Condition{
+			Type:    h2v1alpha2.ConditionProgressing,
+			Status:  corev1.ConditionTrue,
+			Reason:  reasonRollingOut,
+			Message: fmt.Sprintf("StatefulSet %s is rolling out", sts.Name),
+		})
+	} else {
+		h.Status.Conditions.SetCondition(status.Condition{
+			Type:    h2v1alpha2.ConditionProgressing,
+			Status:  corev1.ConditionFalse,
+			Reason:  reasonRolledOut,
+			Message: fmt.Sprintf("StatefulSet %s is rolled out", sts.Name),
+		})
+	}
+}
+
+// setClusterCondition sets the ClusterReady condition from the cluster state in the status
+func setClusterCondition(h *h2v1alpha2.H2Database) {
+	switch h.Status.ClusterState {
+	case h2v1alpha2.ClusterStateFormed:
+		h.Status.Conditions.SetCondition(status.Condition{
+			Type:    h2v1alpha2.ConditionClusterReady,
+			Status:  corev1.ConditionTrue,
+			Reason:  reasonClusterFormed,
+			Message: "The H2 cluster has been formed",
+		})
+	case h2v1alpha2.ClusterStateFailed:
+		// The condition describing the failure is set when the CreateCluster tool fails
+	case h2v1alpha2.ClusterStatePending:
+		h.Status.Conditions.SetCondition(status.Condition{
+			Type:    h2v1alpha2.ConditionClusterReady,
+			Status:  corev1.ConditionFalse,
+			Reason:  reasonClusterPending,
+			Message: "Waiting for exactly 2 H2 instances",
+		})
+	default:
+		h.Status.Conditions.SetCondition(status.Condition{
+			Type:    h2v1alpha2.ConditionClusterReady,
+			Status:  corev1.ConditionFalse,
+			Reason:  reasonClusteringDisabled,
+			Message: "Clustering is disabled",
+		})
+	}
+}
+
+// phaseForH2Database summarizes the conditions, the H2 StatefulSet status and its pods in a phase
+func phaseForH2Database(h *h2v1alpha2.H2Database, sts *appsv1.StatefulSet, pods []corev1.Pod) h2v1alpha2.H2DatabasePhase {
+	switch pod, _ := failedPod(pods); {
+	case pod != "":
+		return h2v1alpha2.PhaseFailed
+	case !h.Status.Conditions.IsTrueFor(h2v1alpha2.ConditionStorageReady):
+		return h2v1alpha2.PhasePending
+	case sts.Status.ReadyReplicas == 0 && *h.Spec.Size > 0:
+		return h2v1alpha2.PhaseProvisioning
+	case sts.Status.ReadyReplicas < *h.Spec.Size:
+		return h2v1alpha2.PhaseDegraded
+	default:
+		return h2v1alpha2.PhaseRunning
+	}
+}
+
+// statefulSetRollingOut returns true until the StatefulSet controller has rolled out the latest pod template
+func statefulSetRollingOut(sts *appsv1.StatefulSet) bool {
+	return sts.Status.ObservedGeneration < sts.Generation ||
+		sts.Status.UpdatedReplicas < *sts.Spec.Replicas ||
+		sts.Status.CurrentRevision != sts.Status.UpdateRevision
+}
+
+// failedPodReasons are the reasons of the containers waiting for a problem only an admin can fix
+var failedPodReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+}
+
+// failedPod returns the name of a H2 pod whose containers cannot start along with the reason, if any.
+// NOTE: Unlike Deployments, StatefulSets have no progress deadline, so the pods are looked at instead.
+func failedPod(pods []corev1.Pod) (string, string) {
+	for _, pod := range pods {
+		for _, cs := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			if w := cs.State.Waiting; w != nil && failedPodReasons[w.Reason] {
+				return pod.Name, fmt.Sprintf("container %s is waiting with %s", cs.Name, w.Reason)
+			}
+		}
+	}
+	return "", ""
+}
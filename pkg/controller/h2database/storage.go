@@ -0,0 +1,82 @@
+package h2database
+
+import (
+	"context"
+	"fmt"
+
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// dataVolumeName is the name of the volume holding the H2 data directory, and of the claim template it is created from
+const dataVolumeName = "h2-data"
+
+// dataVolumeClaimTemplate returns the claim template of the StatefulSet, every H2 instance gets its own data volume
+func dataVolumeClaimTemplate(h *h2v1alpha2.H2Database) corev1.PersistentVolumeClaim {
+	fs := corev1.PersistentVolumeFilesystem
+	return corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   dataVolumeName,
+			Labels: labelsForH2Database(h.Name),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: h.Spec.Storage.Size,
+				},
+			},
+			StorageClassName: h.Spec.Storage.StorageClassName,
+			VolumeMode:       &fs,
+		},
+	}
+}
+
+// dataVolumeClaimName returns the name of the PVC the StatefulSet creates for the data of the given H2 instance
+func dataVolumeClaimName(h *h2v1alpha2.H2Database, ordinal int32) string {
+	return fmt.Sprintf("%s-%s-%d", dataVolumeName, h.Name, ordinal)
+}
+
+// listDataClaims returns the data volume claims of the instances of the given H2 CR, including the ones
+// of the instances removed by scaling down, which are kept by the StatefulSet
+func listDataClaims(c client.Client, h *h2v1alpha2.H2Database) ([]corev1.PersistentVolumeClaim, error) {
+	claims := &corev1.PersistentVolumeClaimList{}
+	err := c.List(context.TODO(), claims, client.InNamespace(h.Namespace), client.MatchingLabels(labelsForH2Database(h.Name)))
+	return claims.Items, err
+}
+
+// reconcileDataClaims makes the given H2 CR the controller of the data volume claims of its instances, the ones
+// created by the StatefulSet as well as the ones retained by a deleted H2 CR of the same name, so that the
+// deletion policy applies to them. It returns the claims.
+func (r *ReconcileH2Database) reconcileDataClaims(h *h2v1alpha2.H2Database) ([]corev1.PersistentVolumeClaim, error) {
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name)
+	claims, err := listDataClaims(r.client, h)
+	if err != nil {
+		reqLogger.Error(err, "Failed to list PersistentVolumeClaims.")
+		return nil, err
+	}
+	for i := range claims {
+		claim := &claims[i]
+		if _, ok := claim.Annotations[retainedAnnotation]; ok {
+			if err := r.adoptRetained(h, claim); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if metav1.GetControllerOf(claim) != nil {
+			continue
+		}
+		reqLogger.Info("Owning the PersistentVolumeClaim of an instance.", "PersistentVolumeClaim.Name", claim.Name)
+		if err := controllerutil.SetControllerReference(h, claim, r.scheme); err != nil {
+			return nil, err
+		}
+		if err := r.client.Update(context.TODO(), claim); err != nil {
+			reqLogger.Error(err, "Failed to own the PersistentVolumeClaim.", "PersistentVolumeClaim.Name", claim.Name)
+			return nil, err
+		}
+	}
+	return claims, nil
+}
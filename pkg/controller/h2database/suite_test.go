@@ -0,0 +1,184 @@
+package h2database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/apis"
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/controller/h2database/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// The suite runs the controller against a local etcd and kube-apiserver started by envtest from the binaries
+// in $KUBEBUILDER_ASSETS, downloaded by make test, without any other controller: StatefulSets get no pods
+// and nothing is garbage collected.
+// NOTE: The CRDs are served as apiextensions.k8s.io/v1beta1, which needs a kube-apiserver up to 1.21.
+var (
+	testEnv    *envtest.Environment
+	testClient client.Client
+)
+
+var _ PodExecutor = &fake.PodExecutor{}
+
+func TestMain(m *testing.M) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		// A CI run must not pass without running the suite
+		if os.Getenv("CI") != "" {
+			fmt.Fprintln(os.Stderr, "KUBEBUILDER_ASSETS is not set, run the tests with make test")
+			os.Exit(1)
+		}
+		// The tests skip themselves
+		os.Exit(m.Run())
+	}
+
+	testEnv = &envtest.Environment{
+		CRDDirectoryPaths: []string{filepath.Join("..", "..", "..", "deploy", "crds")},
+	}
+	cfg, err := testEnv.Start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start the test environment: %v\n", err)
+		os.Exit(1)
+	}
+	code := func() int {
+		defer testEnv.Stop()
+		if err := apis.AddToScheme(scheme.Scheme); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to register the APIs: %v\n", err)
+			return 1
+		}
+		testClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create the client: %v\n", err)
+			return 1
+		}
+		return m.Run()
+	}()
+	os.Exit(code)
+}
+
+// requireEnvironment skips the test when the envtest binaries are not available
+func requireEnvironment(t *testing.T) {
+	t.Helper()
+	if testEnv == nil {
+		t.Skip("KUBEBUILDER_ASSETS is not set, skipping the envtest suite")
+	}
+}
+
+// newTestReconciler returns a reconciler using the test API server and the given executor
+func newTestReconciler(executor PodExecutor) *ReconcileH2Database {
+	return &ReconcileH2Database{
+		client:   testClient,
+		scheme:   scheme.Scheme,
+		recorder: &record.FakeRecorder{},
+		executor: executor,
+	}
+}
+
+// newTestNamespace creates a namespace of its own for a test
+func newTestNamespace(t *testing.T) string {
+	t.Helper()
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "h2-test-"}}
+	if err := testClient.Create(context.TODO(), ns); err != nil {
+		t.Fatalf("Failed to create the namespace: %v", err)
+	}
+	return ns.Name
+}
+
+// newTestH2Database creates an H2 CR with the spec changed by mutate, if not nil
+func newTestH2Database(t *testing.T, namespace string, mutate func(*h2v1alpha2.H2Database)) *h2v1alpha2.H2Database {
+	t.Helper()
+	h := &h2v1alpha2.H2Database{ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: namespace}}
+	h.Default()
+	if mutate != nil {
+		mutate(h)
+	}
+	if err := testClient.Create(context.TODO(), h); err != nil {
+		t.Fatalf("Failed to create the H2Database: %v", err)
+	}
+	return h
+}
+
+// reconcileTestH2Database runs a reconciliation of the given H2 CR, which must succeed
+func reconcileTestH2Database(t *testing.T, r *ReconcileH2Database, h *h2v1alpha2.H2Database) reconcile.Result {
+	t.Helper()
+	result, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: h.Namespace, Name: h.Name}})
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	return result
+}
+
+// getTestObject reads the current state of obj, named like the given H2 CR unless name is set
+func getTestObject(t *testing.T, h *h2v1alpha2.H2Database, name string, obj runtime.Object) {
+	t.Helper()
+	if name == "" {
+		name = h.Name
+	}
+	if err := testClient.Get(context.TODO(), types.NamespacedName{Namespace: h.Namespace, Name: name}, obj); err != nil {
+		t.Fatalf("Failed to get %s: %v", name, err)
+	}
+}
+
+// createTestPod creates a pod of the given H2 CR with the given IP, standing in for the StatefulSet controller
+func createTestPod(t *testing.T, h *h2v1alpha2.H2Database, name, ip string) *corev1.Pod {
+	t.Helper()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: h.Namespace, Labels: labelsForH2Database(h.Name)},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: h2ContainerName, Image: h.Spec.Image}},
+		},
+	}
+	if err := testClient.Create(context.TODO(), pod); err != nil {
+		t.Fatalf("Failed to create the pod: %v", err)
+	}
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.PodIP = ip
+	pod.Status.PodIPs = []corev1.PodIP{{IP: ip}}
+	if err := testClient.Status().Update(context.TODO(), pod); err != nil {
+		t.Fatalf("Failed to update the pod status: %v", err)
+	}
+	return pod
+}
+
+// createTestClaim creates the data volume claim of the given instance of the H2 CR, standing in for the StatefulSet
+// controller, and binds it if asked to
+func createTestClaim(t *testing.T, h *h2v1alpha2.H2Database, ordinal int32, bound bool) *corev1.PersistentVolumeClaim {
+	t.Helper()
+	claim := dataVolumeClaimTemplate(h)
+	claim.Name = dataVolumeClaimName(h, ordinal)
+	claim.Namespace = h.Namespace
+	if err := testClient.Create(context.TODO(), &claim); err != nil {
+		t.Fatalf("Failed to create the claim: %v", err)
+	}
+	if bound {
+		claim.Status.Phase = corev1.ClaimBound
+		if err := testClient.Status().Update(context.TODO(), &claim); err != nil {
+			t.Fatalf("Failed to update the claim status: %v", err)
+		}
+	}
+	return &claim
+}
+
+// setTestPodReady marks the pod as created from the given pod template and passing its readiness probe
+func setTestPodReady(t *testing.T, pod *corev1.Pod, template string) {
+	t.Helper()
+	pod.Annotations = map[string]string{podTemplateHashAnnotation: template}
+	if err := testClient.Update(context.TODO(), pod); err != nil {
+		t.Fatalf("Failed to update the pod: %v", err)
+	}
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	if err := testClient.Status().Update(context.TODO(), pod); err != nil {
+		t.Fatalf("Failed to update the pod status: %v", err)
+	}
+}
@@ -0,0 +1,339 @@
+package h2database
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"time"
+
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Paths and keys used for the TLS material of the H2 servers
+const (
+	h2TLSDir = "/opt/h2-tls"
+
+	keystoreKey         = "keystore.jks"
+	truststoreKey       = "truststore.jks"
+	keystorePasswordKey = "password"
+	caCertKey           = "ca.crt"
+	caKeyKey            = "ca.key"
+
+	// keystoreSourceAnnotation holds the hash of the certificate the keystore was built from
+	keystoreSourceAnnotation = "h2.example.com/keystore-source-hash"
+	// certificateNotAfterAnnotation changes the pod template whenever the serving certificate is replaced,
+	// since the H2 servers only read their keystore on startup
+	certificateNotAfterAnnotation = "h2.example.com/certificate-not-after"
+)
+
+// Validity of the certificates generated by the operator, they are renewed after two thirds of it
+// NOTE: The periodic resync of the controller is enough to notice that a renewal is due.
+const (
+	caValidity      = 10 * 365 * 24 * time.Hour
+	servingValidity = 365 * 24 * time.Hour
+)
+
+// tlsSecretName returns the name of the Secret holding the serving certificate of the given H2 CR
+func tlsSecretName(h *h2v1alpha2.H2Database) string {
+	if h.Spec.TLS.SecretName != "" {
+		return h.Spec.TLS.SecretName
+	}
+	return h.Name + "-tls"
+}
+
+// caSecretName returns the name of the Secret holding the CA generated for the given H2 CR
+func caSecretName(h *h2v1alpha2.H2Database) string {
+	return h.Name + "-ca"
+}
+
+// keystoreSecretName returns the name of the Secret holding the Java keystores of the given H2 CR
+func keystoreSecretName(h *h2v1alpha2.H2Database) string {
+	return h.Name + "-keystore"
+}
+
+// caBundleName returns the name of the ConfigMap publishing the CA bundle of the given H2 CR
+func caBundleName(h *h2v1alpha2.H2Database) string {
+	return h.Name + "-ca-bundle"
+}
+
+// reconcileTLS makes sure the serving certificate, the keystore Secret and the CA bundle ConfigMap of the
+// given H2 CR are up to date, and records the CA bundle and the certificate expiry in the status.
+// It returns false if the Secret supplied by the user does not exist yet.
+func (r *ReconcileH2Database) reconcileTLS(h *h2v1alpha2.H2Database) (bool, error) {
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name)
+	now := time.Now()
+
+	// Check if the serving certificate already exists, if not issue a new one from the operator's CA
+	// NOTE: A Secret supplied by the user is never created nor modified by the operator.
+	source := &corev1.Secret{}
+	if h.Spec.TLS.SecretName != "" {
+		err := r.client.Get(context.TODO(), types.NamespacedName{Name: h.Spec.TLS.SecretName, Namespace: h.Namespace}, source)
+		if err != nil && errors.IsNotFound(err) {
+			reqLogger.Info("Waiting for the TLS Secret to be created.", "Secret.Namespace", h.Namespace, "Secret.Name", h.Spec.TLS.SecretName)
+			r.recorder.Eventf(h, corev1.EventTypeWarning, eventReasonSecretMissing, "Waiting for the TLS Secret %s", h.Spec.TLS.SecretName)
+			return false, nil
+		} else if err != nil {
+			reqLogger.Error(err, "Failed to get TLS Secret.")
+			return false, err
+		}
+	} else {
+		ca := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: caSecretName(h), Namespace: h.Namespace}}
+		op, err := controllerutil.CreateOrUpdate(context.TODO(), r.client, ca, func() error {
+			if !certificateDue(ca.Data[caCertKey], nil, now) {
+				return nil
+			}
+			certPEM, keyPEM, err := generateCertificate(fmt.Sprintf("%s.%s H2 CA", h.Name, h.Namespace), nil, nil, nil, now)
+			if err != nil {
+				return err
+			}
+			ca.Labels = labelsForH2Database(h.Name)
+			ca.Data = map[string][]byte{caCertKey: certPEM, caKeyKey: keyPEM}
+			return controllerutil.SetControllerReference(h, ca, r.scheme)
+		})
+		if err != nil {
+			reqLogger.Error(err, "Failed to ensure the CA Secret.", "Secret.Namespace", ca.Namespace, "Secret.Name", ca.Name)
+			return false, err
+		}
+		if op != controllerutil.OperationResultNone {
+			reqLogger.Info("Issued a new CA.", "Secret.Namespace", ca.Namespace, "Secret.Name", ca.Name, "Operation", op)
+			r.recorder.Eventf(h, corev1.EventTypeNormal, eventReasonCertificate, "Issued a new CA in Secret %s", ca.Name)
+		}
+
+		source.ObjectMeta = metav1.ObjectMeta{Name: tlsSecretName(h), Namespace: h.Namespace}
+		op, err = controllerutil.CreateOrUpdate(context.TODO(), r.client, source, func() error {
+			if !bytes.Equal(source.Data[caCertKey], ca.Data[caCertKey]) || certificateDue(source.Data[corev1.TLSCertKey], dnsNamesForH2Database(h), now) {
+				certPEM, keyPEM, err := generateCertificate(h.Name, dnsNamesForH2Database(h), ca.Data[caCertKey], ca.Data[caKeyKey], now)
+				if err != nil {
+					return err
+				}
+				source.Data = map[string][]byte{
+					corev1.TLSCertKey:       certPEM,
+					corev1.TLSPrivateKeyKey: keyPEM,
+					caCertKey:               ca.Data[caCertKey],
+				}
+			}
+			source.Labels = labelsForH2Database(h.Name)
+			source.Type = corev1.SecretTypeTLS
+			return controllerutil.SetControllerReference(h, source, r.scheme)
+		})
+		if err != nil {
+			reqLogger.Error(err, "Failed to ensure the TLS Secret.", "Secret.Namespace", source.Namespace, "Secret.Name", source.Name)
+			return false, err
+		}
+		if op != controllerutil.OperationResultNone {
+			reqLogger.Info("Issued a new serving certificate.", "Secret.Namespace", source.Namespace, "Secret.Name", source.Name, "Operation", op)
+			r.recorder.Eventf(h, corev1.EventTypeNormal, eventReasonCertificate, "Issued a new serving certificate in Secret %s", source.Name)
+		}
+	}
+
+	pair, err := tls.X509KeyPair(source.Data[corev1.TLSCertKey], source.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		reqLogger.Error(err, "Invalid TLS Secret.", "Secret.Namespace", source.Namespace, "Secret.Name", source.Name)
+		r.recorder.Eventf(h, corev1.EventTypeWarning, eventReasonInvalidSecret, "Invalid TLS Secret %s: %v", source.Name, err)
+		return false, nil
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		reqLogger.Error(err, "Invalid TLS Secret.", "Secret.Namespace", source.Namespace, "Secret.Name", source.Name)
+		r.recorder.Eventf(h, corev1.EventTypeWarning, eventReasonInvalidSecret, "Invalid TLS Secret %s: %v", source.Name, err)
+		return false, nil
+	}
+	caPEM := source.Data[caCertKey]
+	if len(caPEM) == 0 {
+		// Without a CA, clients have to trust the serving certificate itself
+		caPEM = source.Data[corev1.TLSCertKey]
+	}
+
+	// Convert the PEM certificate to the Java keystores the H2 servers and tools read,
+	// whenever the certificate changes
+	sourceHash := hashOf(map[string][]byte{
+		corev1.TLSCertKey:       source.Data[corev1.TLSCertKey],
+		corev1.TLSPrivateKeyKey: source.Data[corev1.TLSPrivateKeyKey],
+		caCertKey:               caPEM,
+	})
+	keystore := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: keystoreSecretName(h), Namespace: h.Namespace}}
+	op, err := controllerutil.CreateOrUpdate(context.TODO(), r.client, keystore, func() error {
+		if keystore.Annotations[keystoreSourceAnnotation] != sourceHash {
+			data, err := keystoreDataFor(pair, caPEM, now)
+			if err != nil {
+				return err
+			}
+			keystore.Annotations = map[string]string{keystoreSourceAnnotation: sourceHash}
+			keystore.Data = data
+		}
+		keystore.Labels = labelsForH2Database(h.Name)
+		return controllerutil.SetControllerReference(h, keystore, r.scheme)
+	})
+	if err != nil {
+		reqLogger.Error(err, "Failed to ensure the keystore Secret.", "Secret.Namespace", keystore.Namespace, "Secret.Name", keystore.Name)
+		return false, err
+	}
+	if op != controllerutil.OperationResultNone {
+		reqLogger.Info("Built the Java keystores.", "Secret.Namespace", keystore.Namespace, "Secret.Name", keystore.Name, "Operation", op)
+	}
+
+	// Publish the CA bundle for the clients
+	bundle := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: caBundleName(h), Namespace: h.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(context.TODO(), r.client, bundle, func() error {
+		bundle.Labels = labelsForH2Database(h.Name)
+		bundle.Data = map[string]string{caCertKey: string(caPEM)}
+		return controllerutil.SetControllerReference(h, bundle, r.scheme)
+	})
+	if err != nil {
+		reqLogger.Error(err, "Failed to ensure the CA bundle ConfigMap.", "ConfigMap.Namespace", bundle.Namespace, "ConfigMap.Name", bundle.Name)
+		return false, err
+	}
+
+	h.Status.CABundle = bundle.Name
+	notAfter := metav1.NewTime(leaf.NotAfter)
+	if h.Status.CertificateNotAfter == nil || !h.Status.CertificateNotAfter.Equal(&notAfter) {
+		h.Status.CertificateNotAfter = &notAfter
+	}
+	return true, nil
+}
+
+// keystoreDataFor returns the keystore Secret data for the certificate: a keystore with the key and
+// the certificate chain for the servers, a trust store with the CA for the clients, and their password
+func keystoreDataFor(pair tls.Certificate, caPEM []byte, now time.Time) (map[string][]byte, error) {
+	password, err := generatePassword()
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(pair.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	keystore, err := encodeKeyStore("h2", key, pair.Certificate, password, now)
+	if err != nil {
+		return nil, err
+	}
+	var cas [][]byte
+	for block, rest := pem.Decode(caPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			cas = append(cas, block.Bytes)
+		}
+	}
+	return map[string][]byte{
+		keystoreKey:         keystore,
+		truststoreKey:       encodeTrustStore("ca", cas, password, now),
+		keystorePasswordKey: []byte(password),
+	}, nil
+}
+
+// dnsNamesForH2Database returns the names the H2 servers of the given H2 CR are reached at
+func dnsNamesForH2Database(h *h2v1alpha2.H2Database) []string {
+	return []string{
+		h.Name,
+		fmt.Sprintf("%s.%s", h.Name, h.Namespace),
+		fmt.Sprintf("%s.%s.svc", h.Name, h.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", h.Name, h.Namespace),
+		"localhost",
+	}
+}
+
+// certificateDue returns true if the PEM certificate is missing, has other DNS names than the given ones,
+// or has used up two thirds of its validity
+func certificateDue(certPEM []byte, dnsNames []string, now time.Time) bool {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return true
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true
+	}
+	if dnsNames != nil && !reflect.DeepEqual(cert.DNSNames, dnsNames) {
+		return true
+	}
+	renewAt := cert.NotBefore.Add(cert.NotAfter.Sub(cert.NotBefore) * 2 / 3)
+	return !now.Before(renewAt)
+}
+
+// generateCertificate returns a new PEM certificate and key. It is a self-signed CA when caCertPEM is nil,
+// otherwise a serving certificate for the DNS names signed by the given CA.
+func generateCertificate(commonName string, dnsNames []string, caCertPEM, caKeyPEM []byte, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Hour),
+	}
+	parent, signer := template, interface{}(key)
+	if caCertPEM == nil {
+		template.NotAfter = now.Add(caValidity)
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	} else {
+		template.NotAfter = now.Add(servingValidity)
+		template.DNSNames = dnsNames
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+		template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+
+		ca, err := tls.X509KeyPair(caCertPEM, caKeyPEM)
+		if err != nil {
+			return nil, nil, err
+		}
+		if parent, err = x509.ParseCertificate(ca.Certificate[0]); err != nil {
+			return nil, nil, err
+		}
+		signer = ca.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// tlsEnvForH2Database returns the environment variables pointing the JVMs of the H2 container, including
+// the tools run by the operator, to the keystores; Kubernetes expands the $(VAR) references
+func tlsEnvForH2Database(h *h2v1alpha2.H2Database) []corev1.EnvVar {
+	if !h.Spec.TLS.Enabled {
+		return nil
+	}
+	return []corev1.EnvVar{
+		{Name: "H2_KEYSTORE_PASSWORD", ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: keystoreSecretName(h)},
+				Key:                  keystorePasswordKey,
+			},
+		}},
+		{Name: "JAVA_TOOL_OPTIONS", Value: fmt.Sprintf("-Djavax.net.ssl.keyStore=%[1]s/%[2]s "+
+			"-Djavax.net.ssl.keyStorePassword=$(H2_KEYSTORE_PASSWORD) "+
+			"-Djavax.net.ssl.trustStore=%[1]s/%[3]s "+
+			"-Djavax.net.ssl.trustStorePassword=$(H2_KEYSTORE_PASSWORD) "+
+			"-Dh2.enableAnonymousTLS=false", h2TLSDir, keystoreKey, truststoreKey)},
+	}
+}
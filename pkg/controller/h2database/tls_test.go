@@ -0,0 +1,123 @@
+package h2database
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+// parseTestCertificate returns the certificate of the PEM block
+func parseTestCertificate(t *testing.T, certPEM []byte) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		t.Fatalf("Expected a PEM certificate, got %q", certPEM)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse the certificate: %v", err)
+	}
+	return cert
+}
+
+func TestGenerateCertificate(t *testing.T) {
+	now := time.Now()
+	dnsNames := []string{"example", "example.default.svc", "localhost"}
+	caCertPEM, caKeyPEM, err := generateCertificate("example-ca", nil, nil, nil, now)
+	if err != nil {
+		t.Fatalf("Failed to generate the CA: %v", err)
+	}
+	ca := parseTestCertificate(t, caCertPEM)
+	if !ca.IsCA || ca.Subject.CommonName != "example-ca" || ca.KeyUsage&x509.KeyUsageCertSign == 0 {
+		t.Errorf("Expected a CA named example-ca, got %+v", ca.Subject)
+	}
+	if got := ca.NotAfter.Sub(ca.NotBefore); got != caValidity+time.Hour {
+		t.Errorf("Expected the CA to be valid for %s from an hour ago, got %s", caValidity, got)
+	}
+
+	certPEM, keyPEM, err := generateCertificate("example", dnsNames, caCertPEM, caKeyPEM, now)
+	if err != nil {
+		t.Fatalf("Failed to generate the serving certificate: %v", err)
+	}
+	cert := parseTestCertificate(t, certPEM)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	for _, name := range append(dnsNames, "127.0.0.1") {
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots, CurrentTime: now}); err != nil {
+			t.Errorf("Expected the certificate to be valid for %s, got %v", name, err)
+		}
+	}
+	if cert.IsCA || cert.NotAfter.Sub(cert.NotBefore) != servingValidity+time.Hour {
+		t.Errorf("Expected a serving certificate valid for %s, got one valid until %s", servingValidity, cert.NotAfter)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("Expected the key to match the certificate, got %v", err)
+	}
+
+	// The keystore carries the same key and chain
+	data, err := keystoreDataFor(pair, caCertPEM, now)
+	if err != nil {
+		t.Fatalf("keystoreDataFor failed: %v", err)
+	}
+	password := string(data[keystorePasswordKey])
+	entries := readJKS(t, data[keystoreKey], password)
+	if len(entries) != 1 || len(entries[0].certs) != 1 || !bytes.Equal(entries[0].certs[0], cert.Raw) {
+		t.Fatalf("Expected the serving certificate in the keystore, got %d entries", len(entries))
+	}
+	key, err := x509.ParsePKCS8PrivateKey(recoverJKSKey(t, entries[0].key, password))
+	if err != nil {
+		t.Fatalf("Expected a PKCS#8 key in the keystore, got %v", err)
+	}
+	if public, err := x509.MarshalPKIXPublicKey(key.(*ecdsa.PrivateKey).Public()); err != nil || !bytes.Equal(public, cert.RawSubjectPublicKeyInfo) {
+		t.Errorf("Expected the key of the keystore to match the certificate, got %v", err)
+	}
+	if entries := readJKS(t, data[truststoreKey], password); len(entries) != 1 || !bytes.Equal(entries[0].certs[0], ca.Raw) {
+		t.Errorf("Expected the CA in the trust store, got %d entries", len(entries))
+	}
+}
+
+func TestCertificateDue(t *testing.T) {
+	issued := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	dnsNames := []string{"example", "localhost"}
+	caCertPEM, caKeyPEM, err := generateCertificate("example-ca", nil, nil, nil, issued)
+	if err != nil {
+		t.Fatalf("Failed to generate the CA: %v", err)
+	}
+	certPEM, _, err := generateCertificate("example", dnsNames, caCertPEM, caKeyPEM, issued)
+	if err != nil {
+		t.Fatalf("Failed to generate the serving certificate: %v", err)
+	}
+	// The certificates are valid from an hour before they are issued
+	renewAt := issued.Add(-time.Hour).Add((servingValidity + time.Hour) * 2 / 3)
+
+	tests := []struct {
+		name     string
+		certPEM  []byte
+		dnsNames []string
+		now      time.Time
+		want     bool
+	}{
+		{"missing", nil, dnsNames, issued, true},
+		{"not a certificate", []byte("-----BEGIN CERTIFICATE-----\nbm90IGEgY2VydGlmaWNhdGU=\n-----END CERTIFICATE-----\n"), dnsNames, issued, true},
+		{"fresh", certPEM, dnsNames, issued, false},
+		{"just before two thirds", certPEM, dnsNames, renewAt.Add(-time.Second), false},
+		{"at two thirds", certPEM, dnsNames, renewAt, true},
+		{"expired", certPEM, dnsNames, issued.Add(servingValidity + time.Hour), true},
+		{"other DNS names", certPEM, []string{"renamed", "localhost"}, issued, true},
+		{"DNS names ignored", certPEM, nil, issued, false},
+		{"CA at two thirds", caCertPEM, nil, issued.Add(-time.Hour).Add((caValidity + time.Hour) * 2 / 3), true},
+		{"CA before two thirds", caCertPEM, nil, renewAt, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := certificateDue(tt.certPEM, tt.dnsNames, tt.now); got != tt.want {
+				t.Errorf("Expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
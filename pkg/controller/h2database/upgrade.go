@@ -0,0 +1,439 @@
+package h2database
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// h2VolumeDir is where the whole data volume is mounted when the data directory is one of its subdirectories
+const h2VolumeDir = "/opt/h2-volume"
+
+// upgradeDumpFile is the name of the dump carrying the data over to a new image, at the root of the data volume
+const upgradeDumpFile = "h2-upgrade.sql"
+
+// upgradeImportedFile marks the dump as imported, so that RUNSCRIPT is not run twice on the new data directory
+// when the migration is reconciled again after the import, e.g. when the row counts could not be read
+const upgradeImportedFile = "h2-upgrade.imported"
+
+// upgradeTimeout is how long a migration may keep the clients cut off before it is rolled back
+const upgradeTimeout = 10 * time.Minute
+
+// upgradeRequeueDelay is how long to wait for the pods of a migration to be ready, or to be reachable again
+const upgradeRequeueDelay = 10 * time.Second
+
+// Reasons of the Upgrading condition
+const (
+	reasonUpgradeExporting status.ConditionReason = "Exporting"
+	reasonUpgradeImporting status.ConditionReason = "Importing"
+	reasonUpgradeSucceeded status.ConditionReason = "UpgradeSucceeded"
+	reasonUpgradeFailed    status.ConditionReason = "UpgradeFailed"
+)
+
+// dataLayoutForH2Database returns the image the H2 pods run and the directory of the data volume holding
+// their data directory. With the Migrate strategy the image of the spec is only run once the data has been
+// imported with it, the image the data has been written with is run meanwhile.
+func dataLayoutForH2Database(h *h2v1alpha2.H2Database) (image, subPath string) {
+	if u := h.Status.Upgrade; u != nil && u.Phase == h2v1alpha2.UpgradePhaseImporting {
+		return u.TargetImage, u.TargetDataSubPath
+	}
+	if h.Spec.Upgrade.Strategy == h2v1alpha2.UpgradeStrategyMigrate && h.Status.Image != "" {
+		return h.Status.Image, h.Status.DataSubPath
+	}
+	return h.Spec.Image, h.Status.DataSubPath
+}
+
+// dataVolumeMountForH2Database returns the mount of the H2 data directory
+func dataVolumeMountForH2Database(h *h2v1alpha2.H2Database, readOnly bool) corev1.VolumeMount {
+	_, subPath := dataLayoutForH2Database(h)
+	return corev1.VolumeMount{
+		Name:      dataVolumeName,
+		MountPath: h2DataDir,
+		SubPath:   subPath,
+		ReadOnly:  readOnly,
+	}
+}
+
+// volumeMountsForH2Database returns the mount of the whole data volume in the H2 container, where the dumps
+// of the migrations are read, when the data directory is one of its subdirectories
+func volumeMountsForH2Database(h *h2v1alpha2.H2Database) []corev1.VolumeMount {
+	if _, subPath := dataLayoutForH2Database(h); subPath == "" {
+		return nil
+	}
+	return []corev1.VolumeMount{{
+		Name:      dataVolumeName,
+		MountPath: h2VolumeDir,
+	}}
+}
+
+// volumeRoot returns where the root of the data volume is found in the H2 container
+// when the data directory is the given subdirectory
+func volumeRoot(subPath string) string {
+	if subPath == "" {
+		return h2DataDir
+	}
+	return h2VolumeDir
+}
+
+// upgradeDataSubPath returns the directory of the data volume the data is imported into with the given image
+func upgradeDataSubPath(image string) string {
+	return "data-" + hashOf(image)
+}
+
+// UpgradeInProgress returns true while the data of the given H2 CR is migrated to a new image,
+// the H2 pods are taken out of the Service meanwhile
+func UpgradeInProgress(h *h2v1alpha2.H2Database) bool {
+	u := h.Status.Upgrade
+	return u != nil && (u.Phase == h2v1alpha2.UpgradePhaseExporting || u.Phase == h2v1alpha2.UpgradePhaseImporting)
+}
+
+// recordDataImage records in the status the image the data of the given H2 CR is written with, the one run by
+// the existing StatefulSet if any when it is not known yet
+func recordDataImage(h *h2v1alpha2.H2Database, sts *appsv1.StatefulSet) {
+	if h.Spec.Upgrade.Strategy != h2v1alpha2.UpgradeStrategyMigrate {
+		if !UpgradeInProgress(h) {
+			h.Status.Image = h.Spec.Image
+		}
+		return
+	}
+	if h.Status.Image != "" {
+		return
+	}
+	h.Status.Image = h.Spec.Image
+	if sts == nil {
+		return
+	}
+	for _, c := range sts.Spec.Template.Spec.Containers {
+		if c.Name == h2ContainerName {
+			h.Status.Image = c.Image
+		}
+	}
+}
+
+// reconcileUpgrade migrates the data of the given H2 CR to the image of the spec with the Migrate strategy,
+// one step at a time: the clients are cut off, the data is dumped with SCRIPT TO by the old image, the new image
+// is started on a fresh data directory and the dump imported with RUNSCRIPT FROM; the traffic is switched back
+// once the row counts of the tables are found to match. On failure the old image is restored with its data,
+// which is left untouched by the migration.
+// NOTE: The status is written whenever the migration moves on, since the StatefulSet is rendered from it.
+func (r *ReconcileH2Database) reconcileUpgrade(h *h2v1alpha2.H2Database, sts *appsv1.StatefulSet) (reconcile.Result, error) {
+	u := h.Status.Upgrade
+	switch {
+	case UpgradeInProgress(h) && h.Spec.Upgrade.Strategy != h2v1alpha2.UpgradeStrategyMigrate:
+		return reconcile.Result{Requeue: true}, r.failUpgrade(h, "The upgrade strategy was changed during the migration")
+	case UpgradeInProgress(h) && h.Spec.Image != u.TargetImage:
+		return reconcile.Result{Requeue: true}, r.failUpgrade(h, "The image was changed during the migration")
+	case UpgradeInProgress(h) && time.Since(u.StartTime.Time) > upgradeTimeout:
+		return reconcile.Result{Requeue: true}, r.failUpgrade(h, fmt.Sprintf("The migration did not complete within %s, it was in the %s phase",
+			upgradeTimeout, strings.ToLower(string(u.Phase))))
+	case UpgradeInProgress(h) && u.Phase == h2v1alpha2.UpgradePhaseExporting:
+		return r.exportData(h)
+	case UpgradeInProgress(h):
+		return r.importData(h, sts)
+	case h.Spec.Upgrade.Strategy != h2v1alpha2.UpgradeStrategyMigrate || h.Spec.Image == h.Status.Image:
+		return reconcile.Result{}, nil
+	case u != nil && u.Phase == h2v1alpha2.UpgradePhaseFailed && u.TargetImage == h.Spec.Image:
+		// NOTE: Setting the image back to the one running lets the migration be tried again afterwards.
+		return reconcile.Result{}, nil
+	}
+
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name, "Image", h.Spec.Image)
+	reqLogger.Info("Starting the migration of the data to a new image.")
+	h.Status.Upgrade = &h2v1alpha2.H2DatabaseUpgradeStatus{
+		Phase:             h2v1alpha2.UpgradePhaseExporting,
+		SourceImage:       h.Status.Image,
+		TargetImage:       h.Spec.Image,
+		TargetDataSubPath: upgradeDataSubPath(h.Spec.Image),
+		StartTime:         metav1.Now(),
+	}
+	r.recorder.Eventf(h, corev1.EventTypeNormal, eventReasonUpgradeStarted, "Migrating the data from %s to %s", h.Status.Image, h.Spec.Image)
+	if *h.Spec.Size != 1 {
+		return reconcile.Result{}, r.failUpgrade(h, fmt.Sprintf("Migrating the data needs a single instance, %d are requested", *h.Spec.Size))
+	}
+	h.Status.Conditions.SetCondition(status.Condition{
+		Type:    h2v1alpha2.ConditionUpgrading,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasonUpgradeExporting,
+		Message: fmt.Sprintf("Exporting the data with %s", h.Status.Image),
+	})
+	// The clients are cut off from the next reconciliation on, before the export
+	return reconcile.Result{Requeue: true}, r.updateUpgradeStatus(h)
+}
+
+// exportData dumps the data with the old image into the data volume and counts the rows of the tables.
+// The dump and the counts are taken in a single session in exclusive mode 2, which closes the connections
+// of the other sessions and rejects new ones meanwhile: the counts match the dump, and the clients connected
+// before the Service was emptied can't write rows the dump misses.
+// NOTE: The tables are listed beforehand, a table created meanwhile is missing from the counts and rolls
+// the migration back.
+func (r *ReconcileH2Database) exportData(h *h2v1alpha2.H2Database) (reconcile.Result, error) {
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name)
+	u := h.Status.Upgrade
+	pod, result, err := r.upgradePod(h, func(pod *corev1.Pod) bool { return true })
+	if pod == nil {
+		return result, err
+	}
+
+	tableRecords, err := r.listTables(h, pod)
+	if err != nil {
+		return r.upgradeCommandFailed(h, "Failed to list the exported tables", err)
+	}
+	countQuery, err := rowCountQuery(tableRecords)
+	if err != nil {
+		return r.upgradeCommandFailed(h, "Failed to list the exported tables", err)
+	}
+
+	// NOTE: A directory left by a failed migration to the same image is cleared first.
+	root := volumeRoot(h.Status.DataSubPath)
+	dump := root + "/" + upgradeDumpFile
+	file := h2TmpDir + "/h2_" + operationUpgradeExport + ".csv"
+	script := "SET EXCLUSIVE 2; SCRIPT TO " + QuoteSQLString(dump)
+	output := "true"
+	if countQuery != "" {
+		script += fmt.Sprintf("; CALL CSVWRITE(%s, %s)", QuoteSQLString(file), QuoteSQLString(countQuery))
+		output = "cat " + file
+	}
+	command := fmt.Sprintf("rm -rf %s && rm -f %s %s %s && %s > /dev/null && %s; status=$?; rm -f %s; exit $status",
+		ShellQuote(root+"/"+u.TargetDataSubPath), ShellQuote(dump), ShellQuote(root+"/"+upgradeImportedFile), file,
+		SQLShellCommand(h, script), output, file)
+	reqLogger.Info("Exporting the data.", "Pod.Name", pod.Name)
+	stdout, _, err := AuditedExec(context.TODO(), r.executor, r.recorder, h, pod, operationUpgradeExport, command, command)
+	if err != nil {
+		return r.upgradeCommandFailed(h, "Failed to export the data", err)
+	}
+	countRecords, err := parseCSV(operationUpgradeExport, stdout)
+	if err != nil {
+		return r.upgradeCommandFailed(h, "Failed to count the exported rows", err)
+	}
+	tables, rows, hash, err := sumRowCounts(countRecords)
+	if err != nil {
+		return r.upgradeCommandFailed(h, "Failed to count the exported rows", err)
+	}
+
+	u.Phase = h2v1alpha2.UpgradePhaseImporting
+	u.Tables = tables
+	u.Rows = rows
+	u.RowCountsHash = hash
+	h.Status.Conditions.SetCondition(status.Condition{
+		Type:    h2v1alpha2.ConditionUpgrading,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasonUpgradeImporting,
+		Message: fmt.Sprintf("Importing %d rows in %d tables with %s", rows, tables, u.TargetImage),
+	})
+	r.recorder.Eventf(h, corev1.EventTypeNormal, eventReasonUpgradeExported, "Exported %d rows in %d tables with %s", rows, tables, u.SourceImage)
+	// The StatefulSet is switched to the new image by the next reconciliation
+	return reconcile.Result{Requeue: true}, r.updateUpgradeStatus(h)
+}
+
+// importData imports the dump with the new image once its pod is ready, and checks the row counts of the tables
+func (r *ReconcileH2Database) importData(h *h2v1alpha2.H2Database, sts *appsv1.StatefulSet) (reconcile.Result, error) {
+	reqLogger := log.WithValues("Request.Namespace", h.Namespace, "Request.Name", h.Name)
+	u := h.Status.Upgrade
+	template := sts.Spec.Template.Annotations[podTemplateHashAnnotation]
+	pod, result, err := r.upgradePod(h, func(pod *corev1.Pod) bool {
+		return pod.Annotations[podTemplateHashAnnotation] == template && podIsReady(pod)
+	})
+	if pod == nil {
+		return result, err
+	}
+
+	dump := h2VolumeDir + "/" + upgradeDumpFile
+	imported := h2VolumeDir + "/" + upgradeImportedFile
+	script := strings.TrimSpace("RUNSCRIPT FROM " + QuoteSQLString(dump) + " " + h.Spec.Upgrade.ImportOptions)
+	command := fmt.Sprintf("[ -f %s ] || { %s && touch %s; }", ShellQuote(imported), SQLShellCommand(h, script), ShellQuote(imported))
+	reqLogger.Info("Importing the data.", "Pod.Name", pod.Name)
+	if _, _, err := AuditedExec(context.TODO(), r.executor, r.recorder, h, pod, operationUpgradeImport, command, command); err != nil {
+		return r.upgradeCommandFailed(h, "Failed to import the data", err)
+	}
+	tables, rows, hash, err := r.countRows(h, pod)
+	if err != nil {
+		return r.upgradeCommandFailed(h, "Failed to count the imported rows", err)
+	}
+	if hash != u.RowCountsHash {
+		return reconcile.Result{Requeue: true}, r.failUpgrade(h, fmt.Sprintf("Found %d rows in %d tables after the import, %d rows in %d tables were exported",
+			rows, tables, u.Rows, u.Tables))
+	}
+
+	// NOTE: The data directory of the old image is kept, for admins to roll back by hand.
+	command = "rm -f " + ShellQuote(dump) + " " + ShellQuote(imported)
+	if _, _, err := AuditedExec(context.TODO(), r.executor, r.recorder, h, pod, operationUpgradeCleanup, command, command); err != nil {
+		reqLogger.Error(err, "Failed to remove the dump.")
+	}
+	reqLogger.Info("Migrated the data to a new image.", "Image", u.TargetImage)
+	h.Status.Image = u.TargetImage
+	h.Status.DataSubPath = u.TargetDataSubPath
+	u.Phase = h2v1alpha2.UpgradePhaseSucceeded
+	h.Status.Conditions.SetCondition(status.Condition{
+		Type:    h2v1alpha2.ConditionUpgrading,
+		Status:  corev1.ConditionFalse,
+		Reason:  reasonUpgradeSucceeded,
+		Message: fmt.Sprintf("Migrated %d rows in %d tables to %s", rows, tables, u.TargetImage),
+	})
+	r.recorder.Eventf(h, corev1.EventTypeNormal, eventReasonUpgradeSucceeded, "Migrated %d rows in %d tables to %s", rows, tables, u.TargetImage)
+	// The clients are let in again by the next reconciliation
+	return reconcile.Result{Requeue: true}, r.updateUpgradeStatus(h)
+}
+
+// upgradePod returns the first running H2 pod matching the filter. Without one, it returns when to look again,
+// the migration is failed by reconcileUpgrade once it has been waiting for too long.
+func (r *ReconcileH2Database) upgradePod(h *h2v1alpha2.H2Database, filter func(*corev1.Pod) bool) (*corev1.Pod, reconcile.Result, error) {
+	pods, err := ListRunningPods(r.client, h)
+	if err != nil {
+		log.Error(err, "Failed to list pods.", "H2Database.Namespace", h.Namespace, "H2Database.Name", h.Name)
+		return nil, reconcile.Result{}, err
+	}
+	for i := range pods {
+		if filter(&pods[i]) {
+			return &pods[i], reconcile.Result{}, nil
+		}
+	}
+	return nil, reconcile.Result{RequeueAfter: upgradeRequeueDelay}, nil
+}
+
+// upgradeCommandFailed fails the migration after a remote command failed or gave an unexpected output,
+// unless it could not be started and can be retried. The retries are spaced by upgradeRequeueDelay rather
+// than the backoff of the controller, so that the migration is rolled back on time.
+// NOTE: Without the pods/exec permission the commands are never started, the migration is rolled back right away.
+func (r *ReconcileH2Database) upgradeCommandFailed(h *h2v1alpha2.H2Database, message string, err error) (reconcile.Result, error) {
+	var rcErr *RemoteCommandError
+	if errors.As(err, &rcErr) && rcErr.Reason == RemoteCommandConnectionError && !apierrors.IsForbidden(rcErr.Err) {
+		log.Error(err, message+", retrying.", "H2Database.Namespace", h.Namespace, "H2Database.Name", h.Name)
+		return reconcile.Result{RequeueAfter: upgradeRequeueDelay}, nil
+	}
+	return reconcile.Result{Requeue: true}, r.failUpgrade(h, message+": "+remoteCommandMessage(err))
+}
+
+// failUpgrade records the failure of the migration, which rolls the StatefulSet back to the old image and data
+func (r *ReconcileH2Database) failUpgrade(h *h2v1alpha2.H2Database, message string) error {
+	u := h.Status.Upgrade
+	log.Info("Rolling back the migration of the data.", "H2Database.Namespace", h.Namespace, "H2Database.Name", h.Name, "Reason", message)
+	u.Phase = h2v1alpha2.UpgradePhaseFailed
+	u.Message = message
+	h.Status.Conditions.SetCondition(status.Condition{
+		Type:    h2v1alpha2.ConditionUpgrading,
+		Status:  corev1.ConditionFalse,
+		Reason:  reasonUpgradeFailed,
+		Message: message,
+	})
+	r.recorder.Eventf(h, corev1.EventTypeWarning, eventReasonUpgradeFailed, "Migration to %s rolled back to %s: %s", u.TargetImage, u.SourceImage, message)
+	return r.updateUpgradeStatus(h)
+}
+
+// updateUpgradeStatus writes the status of the given H2 CR when the migration moves on
+func (r *ReconcileH2Database) updateUpgradeStatus(h *h2v1alpha2.H2Database) error {
+	err := r.client.Status().Update(context.TODO(), h)
+	if err != nil {
+		log.Error(err, "Failed to update H2Database status.", "H2Database.Namespace", h.Namespace, "H2Database.Name", h.Name)
+	}
+	return err
+}
+
+// countRows counts the rows of every table of the database through the pod. It returns the number of tables
+// and rows, and a hash of the counts by table.
+// NOTE: The results are written with CSVWRITE, since the output of the H2 Shell is meant for humans.
+func (r *ReconcileH2Database) countRows(h *h2v1alpha2.H2Database, pod *corev1.Pod) (int32, int64, string, error) {
+	records, err := r.listTables(h, pod)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	query, err := rowCountQuery(records)
+	if err != nil || query == "" {
+		return 0, 0, "", err
+	}
+	records, err = r.querySQL(h, pod, operationUpgradeRowCount, query)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return sumRowCounts(records)
+}
+
+// listTables returns the schema and the name of every table of the database through the pod
+func (r *ReconcileH2Database) listTables(h *h2v1alpha2.H2Database, pod *corev1.Pod) ([][]string, error) {
+	// H2 1.4 lists the tables as 'TABLE', and 2.x as 'BASE TABLE'
+	return r.querySQL(h, pod, operationUpgradeTables, "SELECT TABLE_SCHEMA, TABLE_NAME FROM INFORMATION_SCHEMA.TABLES "+
+		"WHERE TABLE_TYPE IN ('TABLE', 'BASE TABLE') AND TABLE_SCHEMA <> 'INFORMATION_SCHEMA' ORDER BY 1, 2")
+}
+
+// rowCountQuery returns the query counting the rows of the tables listed by listTables, or nothing without tables
+func rowCountQuery(tables [][]string) (string, error) {
+	var queries []string
+	for _, record := range tables {
+		if len(record) != 2 {
+			return "", fmt.Errorf("unexpected table record %q", record)
+		}
+		queries = append(queries, fmt.Sprintf("SELECT %s, COUNT(*) FROM %s.%s",
+			QuoteSQLString(record[0]+"."+record[1]), quoteSQLIdentifier(record[0]), quoteSQLIdentifier(record[1])))
+	}
+	return strings.Join(queries, " UNION ALL "), nil
+}
+
+// sumRowCounts returns the number of tables and rows found by the query of rowCountQuery, and a hash of the counts by table
+func sumRowCounts(records [][]string) (int32, int64, string, error) {
+	counts := map[string]int64{}
+	for _, record := range records {
+		if len(record) != 2 {
+			return 0, 0, "", fmt.Errorf("unexpected row count record %q", record)
+		}
+		count, err := strconv.ParseInt(record[1], 10, 64)
+		if err != nil {
+			return 0, 0, "", fmt.Errorf("unexpected row count %q", record[1])
+		}
+		counts[record[0]] = count
+	}
+	var rows int64
+	for _, count := range counts {
+		rows += count
+	}
+	return int32(len(counts)), rows, hashOf(counts), nil
+}
+
+// querySQL runs the query in the database through the pod and returns the records of its result, without the header
+func (r *ReconcileH2Database) querySQL(h *h2v1alpha2.H2Database, pod *corev1.Pod, operation, query string) ([][]string, error) {
+	file := h2TmpDir + "/h2_" + operation + ".csv"
+	command := fmt.Sprintf("%s > /dev/null && cat %s; status=$?; rm -f %s; exit $status",
+		SQLShellCommand(h, fmt.Sprintf("CALL CSVWRITE(%s, %s)", QuoteSQLString(file), QuoteSQLString(query))), file, file)
+	stdout, _, err := AuditedExec(context.TODO(), r.executor, r.recorder, h, pod, operation, command, command)
+	if err != nil {
+		return nil, err
+	}
+	return parseCSV(operation, stdout)
+}
+
+// parseCSV returns the records of the CSV written by a query, without the header
+func parseCSV(operation, output string) ([][]string, error) {
+	records, err := csv.NewReader(strings.NewReader(output)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("unexpected %s output: %v", operation, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[1:], nil
+}
+
+// quoteSQLIdentifier returns s as a quoted SQL identifier
+func quoteSQLIdentifier(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+// podIsReady returns true if the pod passes its readiness probe
+func podIsReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,452 @@
+package h2user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/controller/h2database"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var log = logf.Log.WithName("controller_h2user")
+
+// dropUserFinalizer makes sure the user is dropped from the database before the H2User is deleted
+const dropUserFinalizer = "h2.example.com/drop-user"
+
+// passwordKey is the key of the password in the password Secret
+const passwordKey = "password"
+
+// Operations of the remote commands run for H2Users, as recorded in the audit log and the failures metric
+const (
+	operationDropUser  = "drop-user"
+	operationApplyUser = "apply-user"
+)
+
+// notReadyRequeueDelay is how long to wait for the database to become available
+const notReadyRequeueDelay = 30 * time.Second
+
+// Reasons of the H2User Ready condition
+const (
+	reasonApplied          status.ConditionReason = "Applied"
+	reasonApplyFailed      status.ConditionReason = "ApplyFailed"
+	reasonDatabaseNotReady status.ConditionReason = "DatabaseNotReady"
+	reasonInvalidSecret    status.ConditionReason = "InvalidSecret"
+)
+
+// Add creates a new H2User Controller and adds it to the Manager. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	r, err := newReconciler(mgr)
+	if err != nil {
+		return err
+	}
+	return add(mgr, r)
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) (reconcile.Reconciler, error) {
+	executor, err := h2database.NewPodExecutor(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+	return &ReconcileH2User{client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: mgr.GetEventRecorderFor("h2user-controller"), executor: executor}, nil
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("h2user-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource H2User
+	err = c.Watch(&source.Kind{Type: &h2v1alpha2.H2User{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to the databases and password Secrets the users refer to
+	err = c.Watch(&source.Kind{Type: &h2v1alpha2.H2Database{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: usersReferringTo(mgr.GetClient(), func(u *h2v1alpha2.H2User) string { return u.Spec.Database }),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: usersReferringTo(mgr.GetClient(), func(u *h2v1alpha2.H2User) string { return u.Spec.PasswordSecret }),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// usersReferringTo maps an object to the H2Users in its namespace whose ref function returns its name
+func usersReferringTo(c client.Client, ref func(*h2v1alpha2.H2User) string) handler.ToRequestsFunc {
+	return func(a handler.MapObject) []reconcile.Request {
+		users := &h2v1alpha2.H2UserList{}
+		if err := c.List(context.TODO(), users, client.InNamespace(a.Meta.GetNamespace())); err != nil {
+			log.Error(err, "Failed to list H2Users.", "Namespace", a.Meta.GetNamespace())
+			return nil
+		}
+		var requests []reconcile.Request
+		for i := range users.Items {
+			if ref(&users.Items[i]) == a.Meta.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+					Name:      users.Items[i].Name,
+					Namespace: users.Items[i].Namespace,
+				}})
+			}
+		}
+		return requests
+	}
+}
+
+// blank assignment to verify that ReconcileH2User implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileH2User{}
+
+// ReconcileH2User reconciles a H2User object
+type ReconcileH2User struct {
+	// This client, initialized using mgr.Client() above, is a split client
+	// that reads objects from the cache and writes to the apiserver
+	client   client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	executor h2database.PodExecutor
+}
+
+// Reconcile reads that state of the cluster for a H2User object and makes changes based on the state read
+// and what is in the H2User.Spec
+// ***************************************************************************
+// Currently this Reconcile loop does the following thigs:
+// Wait for the H2Database to be resumed when it is paused, or for the migration of its data to end
+// Drop the user from the database when the H2User is being deleted
+// Generate the password Secret if it doesn't exist
+// Rotate the password when the rotation interval elapsed or the rotate-password annotation changed
+// Create the user, set its password and admin flag, and apply its grants through one of the H2 pods,
+// whenever the spec or the password changed since they were last applied
+func (r *ReconcileH2User) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	reqLogger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+	reqLogger.Info("Reconciling H2User")
+
+	// Fetch the H2User instance
+	instance := &h2v1alpha2.H2User{}
+	err := r.client.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Request object not found, could have been deleted after reconcile request.
+			// Return and don't requeue
+			h2database.ForgetRemoteCommandFailures(request.Namespace, request.Name, operationDropUser, operationApplyUser)
+			return reconcile.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		reqLogger.Error(err, "Failed to get H2User.")
+		return reconcile.Result{}, err
+	}
+	originalStatus := instance.Status.DeepCopy()
+
+	// Fetch the H2Database the user belongs to
+	database := &h2v1alpha2.H2Database{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.Database, Namespace: instance.Namespace}, database)
+	if err != nil && !errors.IsNotFound(err) {
+		reqLogger.Error(err, "Failed to get H2Database.")
+		return reconcile.Result{}, err
+	}
+	databaseFound := err == nil
+	if databaseFound {
+		database.Default()
+	}
+
+	// Leave the database alone while its H2 CR is paused or its data migrated, the changes of the H2Database
+	// requeue the user
+	if databaseFound && (h2database.IsPaused(database) || h2database.UpgradeInProgress(database)) {
+		reqLogger.Info("Skipping the H2User of a paused or upgrading H2Database.")
+		return reconcile.Result{}, nil
+	}
+
+	// Drop the user before letting the H2User go
+	if instance.DeletionTimestamp != nil {
+		if !containsString(instance.Finalizers, dropUserFinalizer) {
+			return reconcile.Result{}, nil
+		}
+		// NOTE: The user is gone along with its database, so there is nothing to drop.
+		if databaseFound && database.DeletionTimestamp == nil {
+			pod, err := r.databasePod(database)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			if pod == nil {
+				reqLogger.Info("Waiting for a running H2 pod to drop the user.")
+				return reconcile.Result{RequeueAfter: notReadyRequeueDelay}, nil
+			}
+			script := fmt.Sprintf("DROP USER IF EXISTS %s", instance.Spec.Username)
+			reqLogger.Info("Dropping the database user.", "Pod.Name", pod.Name, "Username", instance.Spec.Username)
+			command := h2database.SQLScriptCommand(database)
+			redacted := command + " <<< " + h2database.ShellQuote(script)
+			if _, _, err := h2database.AuditedExecWithStdin(context.TODO(), r.executor, r.recorder, instance, pod, operationDropUser, command, redacted, script); err != nil {
+				reqLogger.Error(err, "Failed to drop the database user.")
+				return reconcile.Result{}, err
+			}
+		}
+		controllerutil.RemoveFinalizer(instance, dropUserFinalizer)
+		err := r.client.Update(context.TODO(), instance)
+		if err != nil {
+			reqLogger.Error(err, "Failed to remove the H2User finalizer.")
+		}
+		return reconcile.Result{}, err
+	}
+
+	if !containsString(instance.Finalizers, dropUserFinalizer) {
+		controllerutil.AddFinalizer(instance, dropUserFinalizer)
+		if err := r.client.Update(context.TODO(), instance); err != nil {
+			reqLogger.Error(err, "Failed to add the H2User finalizer.")
+			return reconcile.Result{}, err
+		}
+	}
+
+	// Check if the password Secret already exists, if not generate a new one
+	secret := &corev1.Secret{}
+	err = r.client.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.PasswordSecret, Namespace: instance.Namespace}, secret)
+	if err != nil && errors.IsNotFound(err) {
+		sec, err := r.passwordSecretForH2User(instance)
+		if err != nil {
+			reqLogger.Error(err, "Failed to generate the user password.")
+			return reconcile.Result{}, err
+		}
+		reqLogger.Info("Creating a new password Secret.", "Secret.Namespace", sec.Namespace, "Secret.Name", sec.Name)
+		err = r.client.Create(context.TODO(), sec)
+		if err != nil {
+			reqLogger.Error(err, "Failed to create new password Secret.", "Secret.Namespace", sec.Namespace, "Secret.Name", sec.Name)
+			return reconcile.Result{}, err
+		}
+		// The Secret watch brings us back once it is in the cache
+		return reconcile.Result{}, nil
+	} else if err != nil {
+		reqLogger.Error(err, "Failed to get password Secret.")
+		return reconcile.Result{}, err
+	}
+	password := string(secret.Data[passwordKey])
+	if password == "" {
+		r.setReady(instance, corev1.ConditionFalse, reasonInvalidSecret, fmt.Sprintf("Secret %s has no %q key", secret.Name, passwordKey))
+		return reconcile.Result{}, r.updateStatus(instance, originalStatus)
+	}
+
+	// Publish the next password when a rotation is due, and make it the current one once its grace period is over.
+	// The Secret is updated first so a new password is never lost, the apply below sets it in the database.
+	now := time.Now()
+	rotated := false
+	if rotationDue(instance, secret, now) {
+		nextPassword, err := generatePassword()
+		if err != nil {
+			reqLogger.Error(err, "Failed to generate the user password.")
+			return reconcile.Result{}, err
+		}
+		reqLogger.Info("Publishing the next user password.", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		startRotation(instance, secret, nextPassword, now)
+		rotated = true
+	}
+	if graceExpired(secret, now) {
+		reqLogger.Info("Rotating the user password.", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		completeRotation(secret, now)
+		rotated = true
+	}
+	if rotated {
+		if err := r.client.Update(context.TODO(), secret); err != nil {
+			reqLogger.Error(err, "Failed to rotate the user password.", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+			return reconcile.Result{}, err
+		}
+		password = string(secret.Data[passwordKey])
+	}
+	if _, ok := secret.Annotations[rotatedAtAnnotation]; ok {
+		rotated := lastRotation(secret)
+		if instance.Status.LastRotationTime == nil || !instance.Status.LastRotationTime.Time.Equal(rotated) {
+			instance.Status.LastRotationTime = &metav1.Time{Time: rotated}
+		}
+	}
+	// Come back for the next rotation or the end of the grace period
+	result := reconcile.Result{RequeueAfter: nextRotationCheck(instance, secret, now)}
+
+	// Apply the user to the database when the spec or the password changed
+	appliedHash := hashOf(instance.Spec, password)
+	if appliedHash == instance.Status.AppliedHash {
+		instance.Status.ObservedGeneration = instance.Generation
+		return result, r.updateStatus(instance, originalStatus)
+	}
+
+	if !databaseFound {
+		r.setReady(instance, corev1.ConditionFalse, reasonDatabaseNotReady, fmt.Sprintf("H2Database %s not found", instance.Spec.Database))
+		return reconcile.Result{}, r.updateStatus(instance, originalStatus)
+	}
+	pod, err := r.databasePod(database)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if pod == nil {
+		r.setReady(instance, corev1.ConditionFalse, reasonDatabaseNotReady, fmt.Sprintf("H2Database %s has no running pod", database.Name))
+		if err := r.updateStatus(instance, originalStatus); err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{RequeueAfter: notReadyRequeueDelay}, nil
+	}
+
+	script := userScript(instance, password)
+	reqLogger.Info("Applying the database user.", "Pod.Name", pod.Name, "Username", instance.Spec.Username)
+	// NOTE: The script is fed to the command through stdin, so that the password stays out of the exec request
+	// and of the process list of the pod; the audit records show it with a placeholder instead of the password.
+	command := h2database.SQLScriptCommand(database)
+	redacted := command + " <<< " + h2database.ShellQuote(userScript(instance, "xxxxx"))
+	if _, _, err := h2database.AuditedExecWithStdin(context.TODO(), r.executor, r.recorder, instance, pod, operationApplyUser, command, redacted, script); err != nil {
+		reqLogger.Error(err, "Failed to apply the database user.")
+		r.setReady(instance, corev1.ConditionFalse, reasonApplyFailed, err.Error())
+		if uerr := r.updateStatus(instance, originalStatus); uerr != nil {
+			return reconcile.Result{}, uerr
+		}
+		return reconcile.Result{}, err
+	}
+
+	instance.Status.AppliedHash = appliedHash
+	instance.Status.Grants = instance.Spec.Grants
+	instance.Status.ObservedGeneration = instance.Generation
+	r.setReady(instance, corev1.ConditionTrue, reasonApplied, fmt.Sprintf("User %s applied to H2Database %s", instance.Spec.Username, database.Name))
+	return result, r.updateStatus(instance, originalStatus)
+}
+
+// databasePod returns a running pod of the database, or nil if there is none
+func (r *ReconcileH2User) databasePod(database *h2v1alpha2.H2Database) (*corev1.Pod, error) {
+	pods, err := h2database.ListRunningPods(r.client, database)
+	if err != nil || len(pods) == 0 {
+		return nil, err
+	}
+	return &pods[0], nil
+}
+
+// setReady sets the Ready condition of the H2User
+func (r *ReconcileH2User) setReady(u *h2v1alpha2.H2User, s corev1.ConditionStatus, reason status.ConditionReason, message string) {
+	u.Status.Conditions.SetCondition(status.Condition{
+		Type:    h2v1alpha2.ConditionUserReady,
+		Status:  s,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// updateStatus writes the status of the H2User if it differs from the original one
+func (r *ReconcileH2User) updateStatus(u *h2v1alpha2.H2User, original *h2v1alpha2.H2UserStatus) error {
+	if reflect.DeepEqual(*original, u.Status) {
+		return nil
+	}
+	err := r.client.Status().Update(context.TODO(), u)
+	if err != nil {
+		log.Error(err, "Failed to update H2User status.", "H2User.Namespace", u.Namespace, "H2User.Name", u.Name)
+	}
+	return err
+}
+
+// passwordSecretForH2User returns a Secret with a generated password for the given H2User
+func (r *ReconcileH2User) passwordSecretForH2User(u *h2v1alpha2.H2User) (*corev1.Secret, error) {
+	password, err := generatePassword()
+	if err != nil {
+		return nil, err
+	}
+	sec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      u.Spec.PasswordSecret,
+			Namespace: u.Namespace,
+		},
+		Type: corev1.SecretTypeOpaque,
+		StringData: map[string]string{
+			"username":  strings.ToUpper(u.Spec.Username),
+			passwordKey: password,
+		},
+	}
+	// Set H2User instance as the owner of the Secret.
+	controllerutil.SetControllerReference(u, sec, r.scheme)
+	return sec, nil
+}
+
+// generatePassword returns a random password made of URL-safe characters
+func generatePassword() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// userScript returns the SQL script creating the user, setting its password and admin flag,
+// revoking the previously applied grants and applying the current ones
+// NOTE: The names are validated by the CRD schema, so they are safe to use unquoted.
+func userScript(u *h2v1alpha2.H2User, password string) string {
+	name := u.Spec.Username
+	statements := []string{
+		fmt.Sprintf("CREATE USER IF NOT EXISTS %s PASSWORD %s", name, h2database.QuoteSQLString(password)),
+		fmt.Sprintf("ALTER USER %s SET PASSWORD %s", name, h2database.QuoteSQLString(password)),
+		fmt.Sprintf("ALTER USER %s ADMIN %t", name, u.Spec.Admin),
+	}
+	for _, g := range u.Status.Grants {
+		statements = append(statements, fmt.Sprintf("REVOKE ALL ON %s FROM %s", grantTarget(g), name))
+	}
+	for _, g := range u.Spec.Grants {
+		var privileges []string
+		for _, p := range g.Privileges {
+			privileges = append(privileges, string(p))
+		}
+		statements = append(statements, fmt.Sprintf("GRANT %s ON %s TO %s", strings.Join(privileges, ", "), grantTarget(g), name))
+	}
+	return strings.Join(statements, "; ")
+}
+
+// grantTarget returns the object the grant applies to, in GRANT/REVOKE syntax
+func grantTarget(g h2v1alpha2.H2Grant) string {
+	schema := g.Schema
+	if schema == "" {
+		schema = "PUBLIC"
+	}
+	if g.Table == "" {
+		return "SCHEMA " + schema
+	}
+	return schema + "." + g.Table
+}
+
+// hashOf returns a short hash of the spec and password of a user, without revealing the password
+func hashOf(spec h2v1alpha2.H2UserSpec, password string) string {
+	data, _ := json.Marshal(spec)
+	sum := sha256.Sum256(append(data, password...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// containsString returns true if s is in the list
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,312 @@
+package h2user
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/status"
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/apis"
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/controller/h2database"
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/controller/h2database/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// The tests run the controller against the fake client of controller-runtime, which keeps the objects in memory:
+// nothing is garbage collected and the Secrets keep their stringData.
+
+// newTestReconciler returns a reconciler using a fake client holding the given objects
+func newTestReconciler(t *testing.T, executor h2database.PodExecutor, objs ...runtime.Object) *ReconcileH2User {
+	t.Helper()
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatalf("Failed to register the core APIs: %v", err)
+	}
+	if err := apis.AddToScheme(s); err != nil {
+		t.Fatalf("Failed to register the APIs: %v", err)
+	}
+	return &ReconcileH2User{
+		client:   fakeclient.NewFakeClientWithScheme(s, objs...),
+		scheme:   s,
+		recorder: &record.FakeRecorder{},
+		executor: executor,
+	}
+}
+
+// newTestDatabase returns an H2 CR named example with a running pod
+func newTestDatabase() (*h2v1alpha2.H2Database, *corev1.Pod) {
+	h := &h2v1alpha2.H2Database{ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"}}
+	h.Default()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "example-0",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "h2database", "h2database_cr": "example"},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	return h, pod
+}
+
+// newTestUser returns an H2User of the example database changed by mutate, if not nil
+func newTestUser(mutate func(*h2v1alpha2.H2User)) *h2v1alpha2.H2User {
+	u := &h2v1alpha2.H2User{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: h2v1alpha2.H2UserSpec{
+			Database:       "example",
+			Username:       "app",
+			PasswordSecret: "app-password",
+			Grants: []h2v1alpha2.H2Grant{
+				{Table: "ORDERS", Privileges: []h2v1alpha2.H2Privilege{"SELECT", "INSERT"}},
+			},
+		},
+	}
+	if mutate != nil {
+		mutate(u)
+	}
+	return u
+}
+
+// newTestSecret returns the password Secret of the test user
+func newTestSecret(password string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-password", Namespace: "default"},
+		Data:       map[string][]byte{passwordKey: []byte(password)},
+	}
+}
+
+// reconcileTestUser runs a reconciliation of the test user and returns its result and error
+func reconcileTestUser(r *ReconcileH2User) (reconcile.Result, error) {
+	return r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "app"}})
+}
+
+// getTestObject reads the current state of the named object into obj, which has to be empty since the fields
+// missing from the stored object are left as they are
+func getTestObject(t *testing.T, r *ReconcileH2User, name string, obj runtime.Object) {
+	t.Helper()
+	if err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: name}, obj); err != nil {
+		t.Fatalf("Failed to get %s: %v", name, err)
+	}
+}
+
+// readyCondition returns the Ready condition of the test user
+func readyCondition(t *testing.T, r *ReconcileH2User) status.Condition {
+	t.Helper()
+	u := &h2v1alpha2.H2User{}
+	getTestObject(t, r, "app", u)
+	c := u.Status.Conditions.GetCondition(h2v1alpha2.ConditionUserReady)
+	if c == nil {
+		t.Fatal("Expected the H2User to have a Ready condition")
+	}
+	return *c
+}
+
+func TestReconcileGeneratesPasswordSecret(t *testing.T) {
+	h, pod := newTestDatabase()
+	executor := &fake.PodExecutor{}
+	r := newTestReconciler(t, executor, h, pod, newTestUser(nil))
+
+	if _, err := reconcileTestUser(r); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	sec := &corev1.Secret{}
+	getTestObject(t, r, "app-password", sec)
+	if sec.StringData["username"] != "APP" || len(sec.StringData[passwordKey]) < 32 {
+		t.Errorf("Expected a generated password for APP, got %v", sec.StringData)
+	}
+	if len(sec.OwnerReferences) != 1 || sec.OwnerReferences[0].Name != "app" {
+		t.Errorf("Expected the Secret to be owned by the H2User, got %v", sec.OwnerReferences)
+	}
+	u := &h2v1alpha2.H2User{}
+	getTestObject(t, r, "app", u)
+	if !containsString(u.Finalizers, dropUserFinalizer) {
+		t.Errorf("Expected the %s finalizer, got %v", dropUserFinalizer, u.Finalizers)
+	}
+	if n := len(executor.Commands()); n != 0 {
+		t.Errorf("Expected the user to be applied once the Secret is in the cache, got %d commands", n)
+	}
+}
+
+func TestReconcileAppliesUserOnce(t *testing.T) {
+	h, pod := newTestDatabase()
+	executor := &fake.PodExecutor{}
+	r := newTestReconciler(t, executor, h, pod, newTestUser(nil), newTestSecret("s3cret"))
+
+	if _, err := reconcileTestUser(r); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	commands := executor.Commands()
+	if len(commands) != 1 {
+		t.Fatalf("Expected the user to be applied, got %d commands", len(commands))
+	}
+	if commands[0].Pod.Name != "example-0" {
+		t.Errorf("Expected the user to be applied in example-0, got %s", commands[0].Pod.Name)
+	}
+	for _, statement := range []string{
+		"CREATE USER IF NOT EXISTS app PASSWORD",
+		"s3cret",
+		"ALTER USER app ADMIN false",
+		"GRANT SELECT, INSERT ON PUBLIC.ORDERS TO app",
+	} {
+		if !strings.Contains(commands[0].Stdin, statement) {
+			t.Errorf("Expected the script to contain %q, got %s", statement, commands[0].Stdin)
+		}
+	}
+	// The password is fed through stdin, never on the command line
+	if strings.Contains(commands[0].Command, "s3cret") || strings.Contains(commands[0].Command, "-sql") {
+		t.Errorf("Expected the script to be kept out of the command, got %s", commands[0].Command)
+	}
+	if c := readyCondition(t, r); c.Status != corev1.ConditionTrue || c.Reason != reasonApplied {
+		t.Errorf("Expected the H2User to be ready, got %s %s", c.Status, c.Reason)
+	}
+
+	// Nothing changed, so nothing is applied again
+	if _, err := reconcileTestUser(r); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if n := len(executor.Commands()); n != 1 {
+		t.Errorf("Expected the unchanged user not to be applied again, got %d commands", n)
+	}
+
+	// A grant removed from the spec is revoked
+	u := &h2v1alpha2.H2User{}
+	getTestObject(t, r, "app", u)
+	u.Spec.Grants = nil
+	if err := r.client.Update(context.TODO(), u); err != nil {
+		t.Fatalf("Failed to update the H2User: %v", err)
+	}
+	if _, err := reconcileTestUser(r); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	commands = executor.Commands()
+	if len(commands) != 2 || !strings.Contains(commands[1].Stdin, "REVOKE ALL ON PUBLIC.ORDERS FROM app") ||
+		strings.Contains(commands[1].Stdin, "GRANT") {
+		t.Errorf("Expected the grant to be revoked, got %v", commands)
+	}
+}
+
+func TestReconcileWaitsForDatabasePod(t *testing.T) {
+	h, _ := newTestDatabase()
+	executor := &fake.PodExecutor{}
+	r := newTestReconciler(t, executor, h, newTestUser(nil), newTestSecret("secret"))
+
+	result, err := reconcileTestUser(r)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if result.RequeueAfter != notReadyRequeueDelay {
+		t.Errorf("Expected a requeue after %s, got %v", notReadyRequeueDelay, result)
+	}
+	if c := readyCondition(t, r); c.Status != corev1.ConditionFalse || c.Reason != reasonDatabaseNotReady {
+		t.Errorf("Expected the H2User to wait for the database, got %s %s", c.Status, c.Reason)
+	}
+	if n := len(executor.Commands()); n != 0 {
+		t.Errorf("Expected no command without a running pod, got %d", n)
+	}
+}
+
+func TestReconcileReportsApplyFailure(t *testing.T) {
+	h, pod := newTestDatabase()
+	executor := &fake.PodExecutor{
+		Handler: func(pod *corev1.Pod, command, stdin string) (string, string, error) {
+			return "", "Syntax error", &h2database.RemoteCommandError{Reason: h2database.RemoteCommandExitError, Err: errors.New("exit 1")}
+		},
+	}
+	r := newTestReconciler(t, executor, h, pod, newTestUser(nil), newTestSecret("secret"))
+
+	if _, err := reconcileTestUser(r); err == nil {
+		t.Fatal("Expected the failed apply to be retried")
+	}
+	if c := readyCondition(t, r); c.Status != corev1.ConditionFalse || c.Reason != reasonApplyFailed {
+		t.Errorf("Expected the H2User to report the failure, got %s %s", c.Status, c.Reason)
+	}
+	u := &h2v1alpha2.H2User{}
+	getTestObject(t, r, "app", u)
+	if u.Status.AppliedHash != "" {
+		t.Errorf("Expected the user not to be recorded as applied, got %s", u.Status.AppliedHash)
+	}
+}
+
+func TestReconcileDropsUserOnDeletion(t *testing.T) {
+	h, pod := newTestDatabase()
+	executor := &fake.PodExecutor{}
+	u := newTestUser(func(u *h2v1alpha2.H2User) {
+		u.Finalizers = []string{dropUserFinalizer}
+		u.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	})
+	r := newTestReconciler(t, executor, h, pod, u, newTestSecret("secret"))
+
+	if _, err := reconcileTestUser(r); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	commands := executor.Commands()
+	if len(commands) != 1 || !strings.Contains(commands[0].Stdin, "DROP USER IF EXISTS app") {
+		t.Errorf("Expected the user to be dropped, got %v", commands)
+	}
+	u = &h2v1alpha2.H2User{}
+	getTestObject(t, r, "app", u)
+	if containsString(u.Finalizers, dropUserFinalizer) {
+		t.Errorf("Expected the finalizer to be removed, got %v", u.Finalizers)
+	}
+}
+
+func TestReconcileRotatesPasswordAfterGracePeriod(t *testing.T) {
+	h, pod := newTestDatabase()
+	executor := &fake.PodExecutor{}
+	u := newTestUser(func(u *h2v1alpha2.H2User) {
+		u.Annotations = map[string]string{rotatePasswordAnnotation: "1"}
+	})
+	r := newTestReconciler(t, executor, h, pod, u, newTestSecret("current"))
+
+	// The next password is published, the current one is applied and keeps working
+	result, err := reconcileTestUser(r)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	sec := &corev1.Secret{}
+	getTestObject(t, r, "app-password", sec)
+	next := string(sec.Data[nextPasswordKey])
+	if string(sec.Data[passwordKey]) != "current" || next == "" {
+		t.Fatalf("Expected the next password to be published along with the current one, got %v", sec.Data)
+	}
+	if result.RequeueAfter <= 0 || result.RequeueAfter > defaultGracePeriod {
+		t.Errorf("Expected a requeue at the end of the grace period, got %v", result)
+	}
+	commands := executor.Commands()
+	if len(commands) != 1 || strings.Contains(commands[0].Stdin, next) {
+		t.Fatalf("Expected the current password to be applied, got %v", commands)
+	}
+
+	// Once the grace period is over the next password replaces the current one in the database
+	sec.Annotations[nextPasswordAtAnnotation] = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	if err := r.client.Update(context.TODO(), sec); err != nil {
+		t.Fatalf("Failed to update the Secret: %v", err)
+	}
+	if _, err := reconcileTestUser(r); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	sec = &corev1.Secret{}
+	getTestObject(t, r, "app-password", sec)
+	if _, ok := sec.Data[nextPasswordKey]; ok || string(sec.Data[passwordKey]) != next {
+		t.Errorf("Expected the next password to be the current one, got %v", sec.Data)
+	}
+	commands = executor.Commands()
+	if len(commands) != 2 || !strings.Contains(commands[1].Stdin, next) {
+		t.Errorf("Expected the next password to be set in the database, got %v", commands)
+	}
+	u = &h2v1alpha2.H2User{}
+	getTestObject(t, r, "app", u)
+	if u.Status.LastRotationTime == nil {
+		t.Error("Expected the rotation to be recorded in the status")
+	}
+}
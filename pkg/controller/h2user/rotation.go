@@ -0,0 +1,115 @@
+package h2user
+
+import (
+	"time"
+
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// rotatePasswordAnnotation triggers a rotation of the password of a H2User whenever its value changes
+	rotatePasswordAnnotation = "h2.example.com/rotate-password"
+
+	// rotatedAtAnnotation records on the password Secret when the password was last set in the database by a rotation
+	rotatedAtAnnotation = "h2.example.com/rotated-at"
+	// rotationTriggerAnnotation records on the password Secret the last rotate-password value handled
+	rotationTriggerAnnotation = "h2.example.com/rotation-trigger"
+	// nextPasswordAtAnnotation records on the password Secret when the next password replaces the current one
+	nextPasswordAtAnnotation = "h2.example.com/next-password-at"
+
+	// nextPasswordKey holds the next password in the Secret during the grace period
+	nextPasswordKey = "next-password"
+
+	// defaultGracePeriod is used when the rotation policy doesn't set one
+	defaultGracePeriod = time.Hour
+)
+
+// NOTE: A H2 user has a single password, so a rotation is carried out in two steps: the next password is
+// published in the Secret first, and set in the database once the grace period is over. The current
+// password keeps working meanwhile. The rotation state is kept on the password Secret rather than in the
+// H2User status, so that the passwords and the record of the rotation are written in a single update.
+
+// lastRotation returns when the password in the Secret was last rotated, or when it was created
+func lastRotation(sec *corev1.Secret) time.Time {
+	if t, err := time.Parse(time.RFC3339, sec.Annotations[rotatedAtAnnotation]); err == nil {
+		return t
+	}
+	return sec.CreationTimestamp.Time
+}
+
+// rotationPending returns true if the Secret holds a next password not set in the database yet
+func rotationPending(sec *corev1.Secret) bool {
+	_, ok := sec.Data[nextPasswordKey]
+	return ok
+}
+
+// nextPasswordAt returns when the next password in the Secret replaces the current one
+func nextPasswordAt(sec *corev1.Secret) time.Time {
+	t, _ := time.Parse(time.RFC3339, sec.Annotations[nextPasswordAtAnnotation])
+	return t
+}
+
+// rotationDue returns true if a rotation of the password of the user has to be started now
+func rotationDue(u *h2v1alpha2.H2User, sec *corev1.Secret, now time.Time) bool {
+	if rotationPending(sec) {
+		return false
+	}
+	if trigger := u.Annotations[rotatePasswordAnnotation]; trigger != "" && trigger != sec.Annotations[rotationTriggerAnnotation] {
+		return true
+	}
+	if u.Spec.Rotation == nil || u.Spec.Rotation.Interval == nil || u.Spec.Rotation.Interval.Duration <= 0 {
+		return false
+	}
+	return !now.Before(lastRotation(sec).Add(u.Spec.Rotation.Interval.Duration))
+}
+
+// gracePeriod returns how long the next password is published before it is set in the database
+func gracePeriod(u *h2v1alpha2.H2User) time.Duration {
+	if u.Spec.Rotation == nil || u.Spec.Rotation.GracePeriod == nil {
+		return defaultGracePeriod
+	}
+	return u.Spec.Rotation.GracePeriod.Duration
+}
+
+// startRotation publishes the next password in the Secret, to be set in the database after the grace period
+func startRotation(u *h2v1alpha2.H2User, sec *corev1.Secret, password string, now time.Time) {
+	if sec.Annotations == nil {
+		sec.Annotations = map[string]string{}
+	}
+	sec.Annotations[nextPasswordAtAnnotation] = now.Add(gracePeriod(u)).UTC().Format(time.RFC3339)
+	if trigger := u.Annotations[rotatePasswordAnnotation]; trigger != "" {
+		sec.Annotations[rotationTriggerAnnotation] = trigger
+	}
+	sec.Data[nextPasswordKey] = []byte(password)
+}
+
+// graceExpired returns true if the Secret holds a next password whose grace period is over
+func graceExpired(sec *corev1.Secret, now time.Time) bool {
+	return rotationPending(sec) && !now.Before(nextPasswordAt(sec))
+}
+
+// completeRotation makes the next password the current one, the apply sets it in the database
+func completeRotation(sec *corev1.Secret, now time.Time) {
+	sec.Annotations[rotatedAtAnnotation] = now.UTC().Format(time.RFC3339)
+	delete(sec.Annotations, nextPasswordAtAnnotation)
+	sec.Data[passwordKey] = sec.Data[nextPasswordKey]
+	delete(sec.Data, nextPasswordKey)
+}
+
+// nextRotationCheck returns how long to wait before the rotation state of the user has to be looked at again,
+// or zero if nothing is scheduled
+func nextRotationCheck(u *h2v1alpha2.H2User, sec *corev1.Secret, now time.Time) time.Duration {
+	var next time.Duration
+	schedule := func(at time.Time) {
+		if d := at.Sub(now); d > 0 && (next == 0 || d < next) {
+			next = d
+		}
+	}
+	if rotationPending(sec) {
+		schedule(nextPasswordAt(sec))
+	} else if u.Spec.Rotation != nil && u.Spec.Rotation.Interval != nil && u.Spec.Rotation.Interval.Duration > 0 {
+		schedule(lastRotation(sec).Add(u.Spec.Rotation.Interval.Duration))
+	}
+	return next
+}
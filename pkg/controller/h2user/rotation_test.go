@@ -0,0 +1,79 @@
+package h2user
+
+import (
+	"testing"
+	"time"
+
+	h2v1alpha2 "github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRotationKeepsCurrentPasswordDuringGracePeriod(t *testing.T) {
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	u := &h2v1alpha2.H2User{Spec: h2v1alpha2.H2UserSpec{Rotation: &h2v1alpha2.H2PasswordRotation{
+		Interval:    &metav1.Duration{Duration: 24 * time.Hour},
+		GracePeriod: &metav1.Duration{Duration: time.Hour},
+	}}}
+	sec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.Time{Time: created}},
+		Data:       map[string][]byte{passwordKey: []byte("current")},
+	}
+
+	now := created.Add(23 * time.Hour)
+	if rotationDue(u, sec, now) {
+		t.Fatal("Expected no rotation before the interval elapsed")
+	}
+	if d := nextRotationCheck(u, sec, now); d != time.Hour {
+		t.Errorf("Expected the next check in 1h, got %s", d)
+	}
+
+	now = created.Add(24 * time.Hour)
+	if !rotationDue(u, sec, now) {
+		t.Fatal("Expected a rotation once the interval elapsed")
+	}
+	startRotation(u, sec, "next", now)
+	if string(sec.Data[passwordKey]) != "current" || string(sec.Data[nextPasswordKey]) != "next" {
+		t.Errorf("Expected the next password to be published along with the current one, got %v", sec.Data)
+	}
+	if rotationDue(u, sec, now) || graceExpired(sec, now) {
+		t.Error("Expected the rotation to wait for the grace period")
+	}
+	if d := nextRotationCheck(u, sec, now); d != time.Hour {
+		t.Errorf("Expected the next check at the end of the grace period, got %s", d)
+	}
+
+	now = now.Add(time.Hour)
+	if !graceExpired(sec, now) {
+		t.Fatal("Expected the grace period to be over")
+	}
+	completeRotation(sec, now)
+	if _, ok := sec.Data[nextPasswordKey]; ok || string(sec.Data[passwordKey]) != "next" {
+		t.Errorf("Expected the next password to replace the current one, got %v", sec.Data)
+	}
+	if !lastRotation(sec).Equal(now) {
+		t.Errorf("Expected the rotation to be recorded at %s, got %s", now, lastRotation(sec))
+	}
+	if d := nextRotationCheck(u, sec, now); d != 24*time.Hour {
+		t.Errorf("Expected the next rotation in 24h, got %s", d)
+	}
+}
+
+func TestRotationTriggeredByAnnotation(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	u := &h2v1alpha2.H2User{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{rotatePasswordAnnotation: "1"}}}
+	sec := &corev1.Secret{Data: map[string][]byte{passwordKey: []byte("current")}}
+
+	if !rotationDue(u, sec, now) {
+		t.Fatal("Expected the annotation to trigger a rotation")
+	}
+	startRotation(u, sec, "next", now)
+	completeRotation(sec, now.Add(defaultGracePeriod))
+	if rotationDue(u, sec, now.Add(defaultGracePeriod)) {
+		t.Error("Expected the handled trigger not to rotate the password again")
+	}
+	u.Annotations[rotatePasswordAnnotation] = "2"
+	if !rotationDue(u, sec, now.Add(defaultGracePeriod)) {
+		t.Error("Expected a new trigger to rotate the password again")
+	}
+}
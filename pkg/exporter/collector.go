@@ -0,0 +1,145 @@
+package exporter
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Settings of INFORMATION_SCHEMA.SETTINGS exported as gauges, missing ones are skipped
+var infoSettings = map[string]*prometheus.Desc{
+	"info.CACHE_SIZE": prometheus.NewDesc("h2_cache_size_kilobytes",
+		"Size of the page cache in use.", nil, nil),
+	"info.CACHE_MAX_SIZE": prometheus.NewDesc("h2_cache_max_size_kilobytes",
+		"Maximum size of the page cache.", nil, nil),
+	"info.FILE_READ": prometheus.NewDesc("h2_file_reads",
+		"Pages read from the database file since it was opened, i.e. cache misses.", nil, nil),
+	"info.FILE_WRITE": prometheus.NewDesc("h2_file_writes",
+		"Pages written to the database file since it was opened.", nil, nil),
+}
+
+var (
+	upDesc = prometheus.NewDesc("h2_up",
+		"Whether the database could be queried.", nil, nil)
+	sessionsDesc = prometheus.NewDesc("h2_sessions",
+		"Open sessions, without the one of the exporter.", nil, nil)
+	blockedSessionsDesc = prometheus.NewDesc("h2_sessions_blocked",
+		"Sessions waiting for a lock held by another session.", nil, nil)
+	queryExecutionsDesc = prometheus.NewDesc("h2_query_executions",
+		"Executions of the statements tracked in INFORMATION_SCHEMA.QUERY_STATISTICS, with --query-statistics.", nil, nil)
+	fileSizeDesc = prometheus.NewDesc("h2_database_file_size_bytes",
+		"Size of the database file.", nil, nil)
+)
+
+// collector queries INFORMATION_SCHEMA through the PG server of H2 on every scrape
+type collector struct {
+	config Config
+}
+
+// Describe implements prometheus.Collector
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range infoSettings {
+		ch <- desc
+	}
+	ch <- upDesc
+	ch <- sessionsDesc
+	ch <- blockedSessionsDesc
+	ch <- queryExecutionsDesc
+	ch <- fileSizeDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	if size, ok := c.databaseFileSize(); ok {
+		ch <- prometheus.MustNewConstMetric(fileSizeDesc, prometheus.GaugeValue, size)
+	}
+
+	if err := c.collectDatabase(ch); err != nil {
+		log.Error(err, "Failed to query the database.")
+		ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 1)
+}
+
+// collectDatabase opens a session, reports the metrics read from INFORMATION_SCHEMA and closes it
+func (c *collector) collectDatabase(ch chan<- prometheus.Metric) error {
+	conn, err := dialPG(c.config.PGAddress, c.config.Database, c.config.User, c.config.Password, c.config.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	sessions, err := c.queryNumber(conn, "SELECT COUNT(*) FROM INFORMATION_SCHEMA.SESSIONS")
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(sessionsDesc, prometheus.GaugeValue, sessions-1)
+
+	blocked, err := c.queryNumber(conn, "SELECT COUNT(*) FROM INFORMATION_SCHEMA.SESSIONS WHERE BLOCKER_ID IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(blockedSessionsDesc, prometheus.GaugeValue, blocked)
+
+	// The statistics are only gathered once enabled, the setting applies to the whole database
+	// and lasts until it is closed, so it is left to the configuration
+	if c.config.QueryStatistics {
+		if _, err := conn.query("SET QUERY_STATISTICS TRUE", c.config.Timeout); err != nil {
+			return err
+		}
+		executions, err := c.queryNumber(conn, "SELECT COALESCE(SUM(EXECUTION_COUNT), 0) FROM INFORMATION_SCHEMA.QUERY_STATISTICS")
+		if err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(queryExecutionsDesc, prometheus.GaugeValue, executions)
+	}
+
+	// The columns are selected by position, since their names differ between H2 1.4 and 2.x
+	rows, err := conn.query("SELECT * FROM INFORMATION_SCHEMA.SETTINGS", c.config.Timeout)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if len(row) < 2 || row[0] == nil || row[1] == nil {
+			continue
+		}
+		desc, ok := infoSettings[*row[0]]
+		if !ok {
+			continue
+		}
+		if value, err := strconv.ParseFloat(*row[1], 64); err == nil {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+		}
+	}
+	return nil
+}
+
+// queryNumber returns the single number returned by the SQL statement
+func (c *collector) queryNumber(conn *pgConn, sql string) (float64, error) {
+	rows, err := conn.query(sql, c.config.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) != 1 || len(rows[0]) != 1 || rows[0][0] == nil {
+		return 0, nil
+	}
+	return strconv.ParseFloat(*rows[0][0], 64)
+}
+
+// databaseFileSize returns the size of the MVStore or, for older databases, the PageStore file
+func (c *collector) databaseFileSize() (float64, bool) {
+	for _, ext := range []string{".mv.db", ".h2.db"} {
+		fi, err := os.Stat(filepath.Join(c.config.DataDir, c.config.Database+ext))
+		if err == nil {
+			return float64(fi.Size()), true
+		}
+	}
+	return 0, false
+}
+
+// defaultTimeout bounds every network operation of a scrape
+const defaultTimeout = 10 * time.Second
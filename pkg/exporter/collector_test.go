@@ -0,0 +1,161 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// servePG accepts a session on a local port and answers the queries with the single column rows of
+// results, unknown statements failing; it returns the address and the statements received
+func servePG(t *testing.T, results map[string][]string) (string, func() []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	var mu sync.Mutex
+	var statements []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			t.Errorf("Failed to accept the session: %v", err)
+			return
+		}
+		defer conn.Close()
+		s := newFakePGServer(t, conn)
+		s.readStartup()
+		s.authRequest(0)
+		s.readyForQuery()
+		for {
+			typ, sql := s.read()
+			if typ != 'Q' {
+				return
+			}
+			mu.Lock()
+			statements = append(statements, sql)
+			mu.Unlock()
+			rows, ok := results[sql]
+			if !ok {
+				s.errorResponse("Syntax error in SQL statement " + sql)
+				s.readyForQuery()
+				continue
+			}
+			for _, row := range rows {
+				columns := strings.Split(row, "=")
+				values := make([]*string, len(columns))
+				for i := range columns {
+					values[i] = &columns[i]
+				}
+				s.dataRow(values...)
+			}
+			s.write('C', []byte("SELECT\x00"))
+			s.readyForQuery()
+		}
+	}()
+	return l.Addr().String(), func() []string {
+		<-done
+		mu.Lock()
+		defer mu.Unlock()
+		return statements
+	}
+}
+
+// gather scrapes the collector and returns the value of every metric
+func gather(t *testing.T, c *collector) map[string]float64 {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather the metrics: %v", err)
+	}
+	values := map[string]float64{}
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			values[f.GetName()] = m.GetGauge().GetValue()
+		}
+	}
+	return values
+}
+
+var databaseResults = map[string][]string{
+	"SELECT COUNT(*) FROM INFORMATION_SCHEMA.SESSIONS":                                  {"3"},
+	"SELECT COUNT(*) FROM INFORMATION_SCHEMA.SESSIONS WHERE BLOCKER_ID IS NOT NULL":     {"1"},
+	"SELECT * FROM INFORMATION_SCHEMA.SETTINGS":                                         {"info.CACHE_SIZE=1024", "info.FILE_READ=12", "info.VERSION=2.1.214", "MODE=REGULAR"},
+	"SET QUERY_STATISTICS TRUE":                                                         nil,
+	"SELECT COALESCE(SUM(EXECUTION_COUNT), 0) FROM INFORMATION_SCHEMA.QUERY_STATISTICS": {"42"},
+}
+
+func TestCollect(t *testing.T) {
+	tests := []struct {
+		name            string
+		queryStatistics bool
+		want            map[string]float64
+	}{
+		{
+			name: "default",
+			want: map[string]float64{
+				"h2_up":                   1,
+				"h2_sessions":             2,
+				"h2_sessions_blocked":     1,
+				"h2_cache_size_kilobytes": 1024,
+				"h2_file_reads":           12,
+			},
+		},
+		{
+			name:            "query statistics",
+			queryStatistics: true,
+			want: map[string]float64{
+				"h2_up":                   1,
+				"h2_sessions":             2,
+				"h2_sessions_blocked":     1,
+				"h2_query_executions":     42,
+				"h2_cache_size_kilobytes": 1024,
+				"h2_file_reads":           12,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, statements := servePG(t, databaseResults)
+			c := &collector{config: Config{PGAddress: addr, Database: "example", DataDir: "/nonexistent", Timeout: testTimeout, QueryStatistics: tt.queryStatistics}}
+			if got := gather(t, c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected the metrics %v, got %v", tt.want, got)
+			}
+			var statistics bool
+			for _, sql := range statements() {
+				statistics = statistics || strings.Contains(sql, "QUERY_STATISTICS")
+			}
+			if statistics != tt.queryStatistics {
+				t.Errorf("Expected the query statistics to be used only when enabled, got %v", statistics)
+			}
+		})
+	}
+}
+
+func TestCollectReportsDownDatabase(t *testing.T) {
+	addr, _ := servePG(t, map[string][]string{})
+	dir, err := ioutil.TempDir("", "h2-exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "example.mv.db"), make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &collector{config: Config{PGAddress: addr, Database: "example", DataDir: dir, Timeout: testTimeout}}
+	want := map[string]float64{"h2_up": 0, "h2_database_file_size_bytes": 4096}
+	if got := gather(t, c); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the metrics %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,68 @@
+// Package exporter serves Prometheus metrics of an H2 database, it runs as a sidecar of the H2 pods
+// and reads INFORMATION_SCHEMA through the PG server of H2 listening on localhost.
+package exporter
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/pflag"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Command is the argument of the operator binary running the exporter instead of the operator
+const Command = "h2-exporter"
+
+// DefaultPort is the port serving the metrics
+const DefaultPort int32 = 9188
+
+var log = logf.Log.WithName("exporter")
+
+// Config of the exporter
+type Config struct {
+	ListenAddress string
+	PGAddress     string
+	Database      string
+	DataDir       string
+	User          string
+	Password      string
+	Timeout       time.Duration
+	// QueryStatistics turns on the query statistics of the database, which slow down every statement
+	QueryStatistics bool
+}
+
+// Run parses the arguments and serves the metrics until the process is stopped,
+// the credentials are read from $H2_USER and $H2_PASSWORD
+func Run(args []string) error {
+	config := Config{
+		User:     os.Getenv("H2_USER"),
+		Password: os.Getenv("H2_PASSWORD"),
+	}
+	flags := pflag.NewFlagSet(Command, pflag.ContinueOnError)
+	flags.StringVar(&config.ListenAddress, "listen-address", fmt.Sprintf(":%d", DefaultPort), "Address serving the metrics")
+	flags.StringVar(&config.PGAddress, "pg-address", "localhost:5435", "Address of the PG server of H2")
+	flags.StringVar(&config.Database, "database", "", "Name of the database")
+	flags.StringVar(&config.DataDir, "data-dir", "/opt/h2-data", "Directory of the database files")
+	flags.DurationVar(&config.Timeout, "timeout", defaultTimeout, "Timeout of the queries of a scrape")
+	flags.BoolVar(&config.QueryStatistics, "query-statistics", false, "Turn on the query statistics of the database to export the query executions, at a cost in performance")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if config.Database == "" {
+		return fmt.Errorf("--database is required")
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(&collector{config: config}); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	log.Info("Serving the metrics.", "Address", config.ListenAddress, "Database", config.Database)
+	return http.ListenAndServe(config.ListenAddress, mux)
+}
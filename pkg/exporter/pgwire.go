@@ -0,0 +1,191 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// pgConn is a minimal client of the PostgreSQL wire protocol, just enough to run simple queries
+// against the PG server of H2, which only asks for cleartext passwords.
+type pgConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialPG opens a connection to the PG server at address and logs in
+func dialPG(address, database, user, password string, timeout time.Duration) (*pgConn, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return startPG(conn, database, user, password, timeout)
+}
+
+// startPG logs in on the connection to a PG server, which is closed on failure
+func startPG(conn net.Conn, database, user, password string, timeout time.Duration) (*pgConn, error) {
+	conn.SetDeadline(time.Now().Add(timeout))
+	c := &pgConn{conn: conn, r: bufio.NewReader(conn)}
+
+	// StartupMessage of protocol 3.0
+	var startup []byte
+	startup = appendInt32(startup, 196608)
+	for _, s := range []string{"user", user, "database", database, ""} {
+		startup = append(append(startup, s...), 0)
+	}
+	if err := c.send(0, startup); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	for {
+		typ, msg, err := c.receive()
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		switch typ {
+		case 'R':
+			if len(msg) < 4 {
+				c.Close()
+				return nil, fmt.Errorf("invalid authentication request")
+			}
+			switch code := binary.BigEndian.Uint32(msg); code {
+			case 0:
+				// AuthenticationOk
+			case 3:
+				if err := c.send('p', append([]byte(password), 0)); err != nil {
+					c.Close()
+					return nil, err
+				}
+			default:
+				c.Close()
+				return nil, fmt.Errorf("unsupported authentication method %d", code)
+			}
+		case 'E':
+			c.Close()
+			return nil, pgError(msg)
+		case 'Z':
+			return c, nil
+		}
+	}
+}
+
+// query runs the SQL statement with the simple query protocol and returns the rows as text, NULL being nil
+func (c *pgConn) query(sql string, timeout time.Duration) ([][]*string, error) {
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	if err := c.send('Q', append([]byte(sql), 0)); err != nil {
+		return nil, err
+	}
+
+	var rows [][]*string
+	var queryErr error
+	for {
+		typ, msg, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case 'D':
+			row, err := parseDataRow(msg)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		case 'E':
+			queryErr = pgError(msg)
+		case 'Z':
+			return rows, queryErr
+		}
+	}
+}
+
+// Close terminates the session
+func (c *pgConn) Close() error {
+	c.send('X', nil)
+	return c.conn.Close()
+}
+
+// send writes a message, the startup message has no type
+func (c *pgConn) send(typ byte, body []byte) error {
+	var msg []byte
+	if typ != 0 {
+		msg = append(msg, typ)
+	}
+	msg = appendInt32(msg, uint32(len(body)+4))
+	msg = append(msg, body...)
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+// receive reads a message and returns its type and body
+func (c *pgConn) receive() (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length < 4 || length > 1<<24 {
+		return 0, nil, fmt.Errorf("invalid message length %d", length)
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header[0], body, nil
+}
+
+// parseDataRow returns the column values of a DataRow message
+func parseDataRow(msg []byte) ([]*string, error) {
+	if len(msg) < 2 {
+		return nil, fmt.Errorf("invalid data row")
+	}
+	n := int(binary.BigEndian.Uint16(msg))
+	msg = msg[2:]
+	row := make([]*string, n)
+	for i := 0; i < n; i++ {
+		if len(msg) < 4 {
+			return nil, fmt.Errorf("invalid data row")
+		}
+		length := int32(binary.BigEndian.Uint32(msg))
+		msg = msg[4:]
+		if length < 0 {
+			continue
+		}
+		if len(msg) < int(length) {
+			return nil, fmt.Errorf("invalid data row")
+		}
+		value := string(msg[:length])
+		row[i] = &value
+		msg = msg[length:]
+	}
+	return row, nil
+}
+
+// pgError returns the message of an ErrorResponse
+func pgError(msg []byte) error {
+	for len(msg) > 1 {
+		field := msg[0]
+		end := 1
+		for end < len(msg) && msg[end] != 0 {
+			end++
+		}
+		if field == 'M' {
+			return fmt.Errorf("h2: %s", msg[1:end])
+		}
+		if end+1 > len(msg) {
+			break
+		}
+		msg = msg[end+1:]
+	}
+	return fmt.Errorf("h2: query failed")
+}
+
+func appendInt32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
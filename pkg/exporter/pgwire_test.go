@@ -0,0 +1,282 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTimeout = 5 * time.Second
+
+// fakePGServer plays the server side of a PG session, on one end of a net.Pipe or of a TCP connection
+type fakePGServer struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newFakePGServer(t *testing.T, conn net.Conn) *fakePGServer {
+	conn.SetDeadline(time.Now().Add(testTimeout))
+	return &fakePGServer{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// readStartup reads the StartupMessage and returns its parameters
+func (s *fakePGServer) readStartup() map[string]string {
+	var length uint32
+	if err := binary.Read(s.r, binary.BigEndian, &length); err != nil {
+		s.t.Errorf("Failed to read the startup message: %v", err)
+		return nil
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(s.r, body); err != nil {
+		s.t.Errorf("Failed to read the startup message: %v", err)
+		return nil
+	}
+	if version := binary.BigEndian.Uint32(body); version != 196608 {
+		s.t.Errorf("Expected protocol 3.0, got %d", version)
+	}
+	params := map[string]string{}
+	fields := strings.Split(string(body[4:]), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		params[fields[i]] = fields[i+1]
+	}
+	return params
+}
+
+// read reads a message of the client
+func (s *fakePGServer) read() (byte, string) {
+	typ, body, err := (&pgConn{conn: s.conn, r: s.r}).receive()
+	if err != nil {
+		s.t.Errorf("Failed to read a message of the client: %v", err)
+	}
+	return typ, strings.TrimSuffix(string(body), "\x00")
+}
+
+// write sends a message to the client
+func (s *fakePGServer) write(typ byte, body []byte) {
+	if err := (&pgConn{conn: s.conn}).send(typ, body); err != nil {
+		s.t.Errorf("Failed to send a message to the client: %v", err)
+	}
+}
+
+func (s *fakePGServer) authRequest(code uint32) {
+	s.write('R', appendInt32(nil, code))
+}
+
+func (s *fakePGServer) errorResponse(message string) {
+	s.write('E', []byte("SERROR\x00C42000\x00M"+message+"\x00\x00"))
+}
+
+func (s *fakePGServer) readyForQuery() {
+	s.write('Z', []byte{'I'})
+}
+
+// dataRow sends a DataRow with the given columns, nil being NULL
+func (s *fakePGServer) dataRow(columns ...*string) {
+	body := []byte{byte(len(columns) >> 8), byte(len(columns))}
+	for _, c := range columns {
+		if c == nil {
+			body = appendInt32(body, 0xFFFFFFFF)
+			continue
+		}
+		body = append(appendInt32(body, uint32(len(*c))), *c...)
+	}
+	s.write('D', body)
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// runFakePGServer runs the script on the server end of a pipe, and returns the client end
+func runFakePGServer(t *testing.T, script func(s *fakePGServer)) net.Conn {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		script(newFakePGServer(t, server))
+	}()
+	return client
+}
+
+func TestStartPG(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  func(s *fakePGServer)
+		wantErr string
+	}{
+		{
+			name: "cleartext password",
+			script: func(s *fakePGServer) {
+				params := s.readStartup()
+				if params["user"] != "SA" || params["database"] != "h2" {
+					t.Errorf("Unexpected startup parameters %v", params)
+				}
+				s.authRequest(3)
+				if typ, password := s.read(); typ != 'p' || password != "secret" {
+					t.Errorf("Expected the password, got %c %q", typ, password)
+				}
+				s.authRequest(0)
+				s.write('S', []byte("server_version\x008.2.23\x00"))
+				s.readyForQuery()
+			},
+		},
+		{
+			name: "no password",
+			script: func(s *fakePGServer) {
+				s.readStartup()
+				s.authRequest(0)
+				s.readyForQuery()
+			},
+		},
+		{
+			name: "wrong password",
+			script: func(s *fakePGServer) {
+				s.readStartup()
+				s.authRequest(3)
+				s.read()
+				s.errorResponse("Wrong user name or password")
+			},
+			wantErr: "h2: Wrong user name or password",
+		},
+		{
+			name: "md5 password",
+			script: func(s *fakePGServer) {
+				s.readStartup()
+				s.write('R', append(appendInt32(nil, 5), "salt"...))
+			},
+			wantErr: "unsupported authentication method 5",
+		},
+		{
+			name: "truncated authentication request",
+			script: func(s *fakePGServer) {
+				s.readStartup()
+				s.write('R', []byte{0, 0})
+			},
+			wantErr: "invalid authentication request",
+		},
+		{
+			name: "connection closed",
+			script: func(s *fakePGServer) {
+				s.readStartup()
+			},
+			wantErr: "EOF",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := startPG(runFakePGServer(t, tt.script), "h2", "SA", "secret", testTimeout)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Expected to log in, got %v", err)
+				}
+				conn.Close()
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error with %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPGQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   func(s *fakePGServer)
+		wantRows [][]*string
+		wantErr  string
+	}{
+		{
+			name: "rows",
+			script: func(s *fakePGServer) {
+				if typ, sql := s.read(); typ != 'Q' || sql != "SELECT * FROM INFORMATION_SCHEMA.SETTINGS" {
+					t.Errorf("Expected the query, got %c %q", typ, sql)
+				}
+				s.write('T', []byte{0, 2})
+				s.dataRow(strPtr("info.CACHE_SIZE"), strPtr("1024"))
+				s.dataRow(strPtr("info.VERSION"), nil)
+				s.write('C', []byte("SELECT 2\x00"))
+				s.readyForQuery()
+			},
+			wantRows: [][]*string{{strPtr("info.CACHE_SIZE"), strPtr("1024")}, {strPtr("info.VERSION"), nil}},
+		},
+		{
+			name: "no rows",
+			script: func(s *fakePGServer) {
+				s.read()
+				s.write('C', []byte("SELECT 0\x00"))
+				s.readyForQuery()
+			},
+		},
+		{
+			name: "error response",
+			script: func(s *fakePGServer) {
+				s.read()
+				s.errorResponse(`Table "SETTINGS" not found`)
+				s.readyForQuery()
+			},
+			wantErr: `h2: Table "SETTINGS" not found`,
+		},
+		{
+			name: "truncated data row",
+			script: func(s *fakePGServer) {
+				s.read()
+				s.write('D', append([]byte{0, 1}, appendInt32(nil, 10)...))
+			},
+			wantErr: "invalid data row",
+		},
+		{
+			name: "invalid message length",
+			script: func(s *fakePGServer) {
+				s.read()
+				s.conn.Write([]byte{'D', 0, 0, 0, 2})
+			},
+			wantErr: "invalid message length 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := runFakePGServer(t, tt.script)
+			conn := &pgConn{conn: client, r: bufio.NewReader(client)}
+			defer client.Close()
+			rows, err := conn.query("SELECT * FROM INFORMATION_SCHEMA.SETTINGS", testTimeout)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected an error with %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if !reflect.DeepEqual(rows, tt.wantRows) {
+				t.Errorf("Expected rows %v, got %v", tt.wantRows, rows)
+			}
+		})
+	}
+}
+
+func TestPGError(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want string
+	}{
+		{"message field", "SERROR\x00C90001\x00MSyntax error\x00\x00", "h2: Syntax error"},
+		{"no message field", "SERROR\x00C90001\x00\x00", "h2: query failed"},
+		{"unterminated field", "SERROR", "h2: query failed"},
+		{"empty", "", "h2: query failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pgError([]byte(tt.msg)).Error(); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
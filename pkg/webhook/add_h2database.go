@@ -0,0 +1,15 @@
+package webhook
+
+import (
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha1"
+	"github.com/pwegrzyn/kubernetes-operators-project/pkg/apis/h2/v1alpha2"
+)
+
+func init() {
+	// AddToManagerFuncs is a list of functions to register webhooks with the manager's webhook server.
+	// NOTE: The conversion webhook is registered along with the first convertible version.
+	AddToManagerFuncs = append(AddToManagerFuncs,
+		(&v1alpha1.H2Database{}).SetupWebhookWithManager,
+		(&v1alpha2.H2Database{}).SetupWebhookWithManager,
+	)
+}